@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdapterSettings is a change to a controller's settings; nil fields are
+// left as they are.
+type AdapterSettings struct {
+	Alias               *string
+	Discoverable        *bool
+	DiscoverableTimeout *time.Duration
+	Pairable            *bool
+	PairableTimeout     *time.Duration
+}
+
+func (s AdapterSettings) empty() bool {
+	return s.Alias == nil && s.Discoverable == nil && s.DiscoverableTimeout == nil &&
+		s.Pairable == nil && s.PairableTimeout == nil
+}
+
+// adapterSettingKeys are the names `adapter set` accepts.
+var adapterSettingKeys = []string{"alias", "discoverable", "discoverable-timeout", "pairable", "pairable-timeout"}
+
+// timeoutPresets are the values the settings screen cycles through.
+var timeoutPresets = []time.Duration{0, time.Minute, 3 * time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// parseAdapterSettings reads key=value pairs such as "discoverable=on".
+func parseAdapterSettings(args []string) (AdapterSettings, error) {
+	var s AdapterSettings
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return s, fmt.Errorf("expected key=value, got %q", arg)
+		}
+		if err := s.set(strings.ToLower(key), value); err != nil {
+			return s, err
+		}
+	}
+	if s.empty() {
+		return s, fmt.Errorf("no settings given; use one of %s", strings.Join(adapterSettingKeys, ", "))
+	}
+	return s, nil
+}
+
+func (s *AdapterSettings) set(key, value string) error {
+	switch key {
+	case "alias":
+		if value == "" {
+			return errors.New("alias must not be empty")
+		}
+		s.Alias = &value
+	case "discoverable", "pairable":
+		on, err := parseOnOff(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if key == "discoverable" {
+			s.Discoverable = &on
+		} else {
+			s.Pairable = &on
+		}
+	case "discoverable-timeout", "pairable-timeout":
+		d, err := parseTimeout(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if key == "discoverable-timeout" {
+			s.DiscoverableTimeout = &d
+		} else {
+			s.PairableTimeout = &d
+		}
+	default:
+		return fmt.Errorf("unknown setting %q; use one of %s", key, strings.Join(adapterSettingKeys, ", "))
+	}
+	return nil
+}
+
+func parseOnOff(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "yes", "true", "1":
+		return true, nil
+	case "off", "no", "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not on or off", value)
+}
+
+// parseTimeout accepts seconds ("180"), a duration ("3m") or "never"/"off"
+// for 0, which BlueZ treats as no timeout.
+func parseTimeout(value string) (time.Duration, error) {
+	switch strings.ToLower(value) {
+	case "never", "off":
+		return 0, nil
+	}
+	var d time.Duration
+	if n, err := strconv.ParseUint(value, 10, 32); err == nil {
+		d = time.Duration(n) * time.Second
+	} else if d, err = time.ParseDuration(value); err != nil {
+		return 0, fmt.Errorf("%q is not a number of seconds or a duration", value)
+	}
+	if d < 0 || d%time.Second != 0 || d/time.Second > math.MaxUint32 {
+		return 0, fmt.Errorf("%q is not a whole number of seconds", value)
+	}
+	return d, nil
+}
+
+// formatTimeout renders a timeout the way parseTimeout reads it back.
+func formatTimeout(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "never"
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+// nextTimeout steps through timeoutPresets from d, which need not be a
+// preset itself.
+func nextTimeout(d time.Duration, step int) time.Duration {
+	n := len(timeoutPresets)
+	i := sort.Search(n, func(i int) bool { return timeoutPresets[i] >= d })
+	if (i == n || timeoutPresets[i] != d) && step > 0 {
+		// Between presets, i is already one step up.
+		step--
+	}
+	return timeoutPresets[((i+step)%n+n)%n]
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAdapterSettings(t *testing.T) {
+	s, err := parseAdapterSettings([]string{"Discoverable=yes", "discoverable-timeout=3m", "pairable=off", "alias=desk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Discoverable == nil || !*s.Discoverable || s.Pairable == nil || *s.Pairable {
+		t.Errorf("discoverable %v, pairable %v", s.Discoverable, s.Pairable)
+	}
+	if s.DiscoverableTimeout == nil || *s.DiscoverableTimeout != 3*time.Minute {
+		t.Errorf("discoverable timeout %v, want 3m", s.DiscoverableTimeout)
+	}
+	if s.Alias == nil || *s.Alias != "desk" || s.PairableTimeout != nil {
+		t.Errorf("alias %v, pairable timeout %v", s.Alias, s.PairableTimeout)
+	}
+
+	for _, args := range [][]string{
+		nil,
+		{"discoverable"},
+		{"alias="},
+		{"colour=blue"},
+		{"discoverable=sometimes"},
+		{"pairable-timeout=1.5s"},
+		{"pairable-timeout=-1m"},
+	} {
+		if _, err := parseAdapterSettings(args); err == nil {
+			t.Errorf("%q: expected error", args)
+		}
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"0", 0},
+		{"never", 0},
+		{"180", 3 * time.Minute},
+		{"90s", 90 * time.Second},
+		{"1h", time.Hour},
+	}
+	for _, tc := range tests {
+		got, err := parseTimeout(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("parseTimeout(%q) = %v, %v; want %v", tc.in, got, err, tc.want)
+		}
+		if back, err := parseTimeout(formatTimeout(got)); err != nil || back != got {
+			t.Errorf("formatTimeout(%v) = %q does not round-trip", got, formatTimeout(got))
+		}
+	}
+}
+
+func TestNextTimeout(t *testing.T) {
+	tests := []struct {
+		from time.Duration
+		step int
+		want time.Duration
+	}{
+		{0, 1, time.Minute},
+		{0, -1, 15 * time.Minute},
+		{15 * time.Minute, 1, 0},
+		{2 * time.Minute, 1, 3 * time.Minute},
+		{2 * time.Minute, -1, time.Minute},
+		{time.Hour, 1, 0},
+		{time.Hour, -1, 15 * time.Minute},
+	}
+	for _, tc := range tests {
+		if got := nextTimeout(tc.from, tc.step); got != tc.want {
+			t.Errorf("nextTimeout(%v, %d) = %v, want %v", tc.from, tc.step, got, tc.want)
+		}
+	}
+}
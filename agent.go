@@ -0,0 +1,227 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	bluezAgentManagerIface = "org.bluez.AgentManager1"
+	bluezAgentIface        = "org.bluez.Agent1"
+	agentPath              = dbus.ObjectPath("/org/hyprbluetooth/agent")
+	agentCapability        = "KeyboardDisplay"
+	agentTimeout           = 30 * time.Second
+)
+
+var (
+	errAgentRejected = dbus.NewError("org.bluez.Error.Rejected", []interface{}{"rejected by user"})
+	errAgentCanceled = dbus.NewError("org.bluez.Error.Canceled", []interface{}{"request canceled"})
+)
+
+type PairingRequestKind int
+
+const (
+	PairingRequestPinCode PairingRequestKind = iota
+	PairingRequestPasskey
+	PairingDisplayPinCode
+	PairingDisplayPasskey
+	PairingConfirmation
+	PairingAuthorization
+	PairingAuthorizeService
+	// PairingCanceled tells the UI that BlueZ withdrew the pending request.
+	PairingCanceled
+)
+
+// PairingRequest is one prompt from bluetoothd's agent protocol. Requests
+// that need an answer block the agent until Accept or Reject is called;
+// display-only requests ignore the reply.
+type PairingRequest struct {
+	Kind    PairingRequestKind
+	MAC     string
+	Passkey uint32
+	PinCode string
+	UUID    string
+	Entered uint16
+
+	reply chan pairingReply
+}
+
+type pairingReply struct {
+	accept bool
+	value  string
+}
+
+// NeedsInput reports whether the user has to type a PIN or passkey.
+func (r *PairingRequest) NeedsInput() bool {
+	return r.Kind == PairingRequestPinCode || r.Kind == PairingRequestPasskey
+}
+
+// NeedsReply reports whether the agent is blocked waiting on the user.
+func (r *PairingRequest) NeedsReply() bool {
+	switch r.Kind {
+	case PairingDisplayPinCode, PairingDisplayPasskey, PairingCanceled:
+		return false
+	}
+	return true
+}
+
+func (r *PairingRequest) Accept(value string) { r.respond(pairingReply{accept: true, value: value}) }
+func (r *PairingRequest) Reject()             { r.respond(pairingReply{}) }
+
+func (r *PairingRequest) respond(rep pairingReply) {
+	if r.reply == nil {
+		return
+	}
+	select {
+	case r.reply <- rep:
+	default:
+	}
+}
+
+// PairingAgent is implemented by backends that can register their own
+// pairing agent with bluetoothd. The channel is closed once ctx is done.
+type PairingAgent interface {
+	RegisterAgent(ctx context.Context) (<-chan *PairingRequest, error)
+}
+
+// pairingAgent is the object exported on the bus as org.bluez.Agent1.
+type pairingAgent struct {
+	ctx      context.Context
+	requests chan *PairingRequest
+	timeout  time.Duration
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// deliver hands req to the UI. It holds mu so close can't race a send.
+func (a *pairingAgent) deliver(req *PairingRequest, deadline <-chan time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return false
+	}
+	select {
+	case a.requests <- req:
+		return true
+	case <-a.ctx.Done():
+	case <-deadline:
+	}
+	return false
+}
+
+func (a *pairingAgent) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.closed = true
+	close(a.requests)
+}
+
+func (a *pairingAgent) notify(req *PairingRequest) {
+	a.deliver(req, time.After(a.timeout))
+}
+
+// ask delivers req and waits for the user's answer.
+func (a *pairingAgent) ask(req *PairingRequest) (string, *dbus.Error) {
+	req.reply = make(chan pairingReply, 1)
+	deadline := time.NewTimer(a.timeout)
+	defer deadline.Stop()
+
+	if !a.deliver(req, deadline.C) {
+		return "", errAgentCanceled
+	}
+
+	select {
+	case rep := <-req.reply:
+		if !rep.accept {
+			return "", errAgentRejected
+		}
+		return rep.value, nil
+	case <-a.ctx.Done():
+		return "", errAgentCanceled
+	case <-deadline.C:
+		return "", errAgentCanceled
+	}
+}
+
+func (a *pairingAgent) Release() *dbus.Error {
+	return nil
+}
+
+func (a *pairingAgent) RequestPinCode(device dbus.ObjectPath) (string, *dbus.Error) {
+	return a.ask(&PairingRequest{Kind: PairingRequestPinCode, MAC: macFromDevicePath(device)})
+}
+
+func (a *pairingAgent) DisplayPinCode(device dbus.ObjectPath, pincode string) *dbus.Error {
+	a.notify(&PairingRequest{Kind: PairingDisplayPinCode, MAC: macFromDevicePath(device), PinCode: pincode})
+	return nil
+}
+
+func (a *pairingAgent) RequestPasskey(device dbus.ObjectPath) (uint32, *dbus.Error) {
+	v, derr := a.ask(&PairingRequest{Kind: PairingRequestPasskey, MAC: macFromDevicePath(device)})
+	if derr != nil {
+		return 0, derr
+	}
+	passkey, err := strconv.ParseUint(v, 10, 32)
+	if err != nil || passkey > 999999 {
+		return 0, errAgentRejected
+	}
+	return uint32(passkey), nil
+}
+
+func (a *pairingAgent) DisplayPasskey(device dbus.ObjectPath, passkey uint32, entered uint16) *dbus.Error {
+	a.notify(&PairingRequest{Kind: PairingDisplayPasskey, MAC: macFromDevicePath(device), Passkey: passkey, Entered: entered})
+	return nil
+}
+
+func (a *pairingAgent) RequestConfirmation(device dbus.ObjectPath, passkey uint32) *dbus.Error {
+	_, derr := a.ask(&PairingRequest{Kind: PairingConfirmation, MAC: macFromDevicePath(device), Passkey: passkey})
+	return derr
+}
+
+func (a *pairingAgent) RequestAuthorization(device dbus.ObjectPath) *dbus.Error {
+	_, derr := a.ask(&PairingRequest{Kind: PairingAuthorization, MAC: macFromDevicePath(device)})
+	return derr
+}
+
+func (a *pairingAgent) AuthorizeService(device dbus.ObjectPath, uuid string) *dbus.Error {
+	_, derr := a.ask(&PairingRequest{Kind: PairingAuthorizeService, MAC: macFromDevicePath(device), UUID: uuid})
+	return derr
+}
+
+func (a *pairingAgent) Cancel() *dbus.Error {
+	a.notify(&PairingRequest{Kind: PairingCanceled})
+	return nil
+}
+
+// RegisterAgent exports a pairing agent and makes it the default for
+// bluetoothd. The agent is unregistered when ctx is canceled.
+func (b *dbusBackend) RegisterAgent(ctx context.Context) (<-chan *PairingRequest, error) {
+	agent := &pairingAgent{ctx: ctx, requests: make(chan *PairingRequest), timeout: cmp.Or(b.agentTimeout, agentTimeout)}
+	if err := b.conn.Export(agent, agentPath, bluezAgentIface); err != nil {
+		return nil, fmt.Errorf("failed to export pairing agent: %w", err)
+	}
+	manager := b.conn.Object(bluezService, "/org/bluez")
+	if err := manager.CallWithContext(ctx, bluezAgentManagerIface+".RegisterAgent", 0, agentPath, agentCapability).Err; err != nil {
+		return nil, fmt.Errorf("failed to register pairing agent: %w", err)
+	}
+	if err := manager.CallWithContext(ctx, bluezAgentManagerIface+".RequestDefaultAgent", 0, agentPath).Err; err != nil {
+		return nil, fmt.Errorf("failed to make pairing agent default: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		stopCtx, cancelStop := context.WithTimeout(context.Background(), cmp.Or(b.commandTimeout, cmdTimeout))
+		defer cancelStop()
+		_ = manager.CallWithContext(stopCtx, bluezAgentManagerIface+".UnregisterAgent", 0, agentPath).Err
+		_ = b.conn.Export(nil, agentPath, bluezAgentIface)
+		agent.close()
+	}()
+	return agent.requests, nil
+}
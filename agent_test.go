@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestAgent(t *testing.T, timeout time.Duration) *pairingAgent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &pairingAgent{ctx: ctx, requests: make(chan *PairingRequest), timeout: timeout}
+}
+
+func TestPairingAgentPasskey(t *testing.T) {
+	a := newTestAgent(t, time.Second)
+	path := devicePath(testAdapterPath, testMACHeadphones)
+
+	go func() {
+		req := <-a.requests
+		if req.Kind != PairingRequestPasskey || req.MAC != testMACHeadphones {
+			t.Errorf("unexpected request %+v", req)
+		}
+		req.Accept("012345")
+	}()
+	passkey, derr := a.RequestPasskey(path)
+	if derr != nil {
+		t.Fatal(derr)
+	}
+	if passkey != 12345 {
+		t.Errorf("passkey = %d, want 12345", passkey)
+	}
+
+	go func() { (<-a.requests).Accept("not-a-number") }()
+	if _, derr := a.RequestPasskey(path); derr == nil {
+		t.Error("expected rejection for non-numeric passkey")
+	}
+}
+
+func TestPairingAgentConfirmation(t *testing.T) {
+	a := newTestAgent(t, time.Second)
+	path := devicePath(testAdapterPath, testMACMouse)
+
+	go func() { (<-a.requests).Reject() }()
+	if derr := a.RequestConfirmation(path, 123456); derr == nil || derr.Name != errAgentRejected.Name {
+		t.Errorf("got %v, want %s", derr, errAgentRejected.Name)
+	}
+
+	go func() { (<-a.requests).Accept("") }()
+	if derr := a.RequestConfirmation(path, 123456); derr != nil {
+		t.Errorf("got %v, want nil", derr)
+	}
+}
+
+func TestPairingAgentTimeout(t *testing.T) {
+	a := newTestAgent(t, 20*time.Millisecond)
+
+	// Nobody reads the request, so the agent must give up on its own.
+	if derr := a.RequestAuthorization(devicePath(testAdapterPath, testMACMouse)); derr == nil || derr.Name != errAgentCanceled.Name {
+		t.Errorf("got %v, want %s", derr, errAgentCanceled.Name)
+	}
+
+	// Delivered but never answered.
+	go func() { <-a.requests }()
+	if derr := a.AuthorizeService(devicePath(testAdapterPath, testMACMouse), "0000110b-0000-1000-8000-00805f9b34fb"); derr == nil {
+		t.Error("expected cancellation for unanswered request")
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// HasAlias reports whether the device has been given a name of its own.
+// BlueZ reports the advertised name as the alias otherwise, or the address
+// with dashes when there is no name.
+func (d BluetoothDevice) HasAlias() bool {
+	return d.Alias != "" && d.Alias != d.Name && d.Alias != strings.ReplaceAll(d.MAC, ":", "-")
+}
+
+// DisplayName is the alias if the device has one, else its advertised
+// name, which may be empty.
+func (d BluetoothDevice) DisplayName() string {
+	if d.HasAlias() {
+		return d.Alias
+	}
+	return d.Name
+}
+
+// aliasStore keeps the aliases of devices BlueZ can't hold one for:
+// unpaired devices, which bluetoothd forgets, and every device under the
+// bluetoothctl backend. It is shared by the backends WithAdapter returns.
+type aliasStore struct {
+	path string
+
+	mu      sync.Mutex
+	aliases map[string]string
+}
+
+// defaultAliasPath is $XDG_DATA_HOME/hyprBluetooth/aliases.json, falling
+// back to ~/.local/share as the XDG spec says.
+func defaultAliasPath() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "hyprBluetooth", "aliases.json"), nil
+}
+
+// loadAliases reads the alias file, a JSON object from MAC to alias; a
+// missing file has none. The store is usable, and empty, even when the
+// file can't be read.
+func loadAliases(path string) (*aliasStore, error) {
+	s := &aliasStore{path: path, aliases: map[string]string{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to read aliases: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.aliases); err != nil {
+		s.aliases = map[string]string{}
+		return s, fmt.Errorf("failed to parse aliases %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *aliasStore) get(mac string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alias, ok := s.aliases[strings.ToUpper(mac)]
+	return alias, ok
+}
+
+// set stores alias for mac and saves the file; "" forgets it.
+func (s *aliasStore) set(mac, alias string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mac = strings.ToUpper(mac)
+	if s.aliases[mac] == alias {
+		return nil
+	}
+	if alias == "" {
+		delete(s.aliases, mac)
+	} else {
+		s.aliases[mac] = alias
+	}
+	data, err := json.MarshalIndent(s.aliases, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode aliases: %w", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to save aliases: %w", err)
+	}
+	return nil
+}
+
+func (s *aliasStore) apply(d BluetoothDevice) BluetoothDevice {
+	if alias, ok := s.get(d.MAC); ok {
+		d.Alias = alias
+	}
+	return d
+}
+
+// aliasBackend lays the local aliases over a Backend's devices and renames
+// a device in BlueZ when it is paired, or locally when it isn't.
+type aliasBackend struct {
+	Backend
+	aliases *aliasStore
+}
+
+func withAliases(b Backend, aliases *aliasStore) Backend {
+	return aliasBackend{Backend: b, aliases: aliases}
+}
+
+func (b aliasBackend) ListDevices(ctx context.Context) ([]BluetoothDevice, error) {
+	devices, err := b.Backend.ListDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]BluetoothDevice, len(devices))
+	for i, d := range devices {
+		out[i] = b.aliases.apply(d)
+	}
+	return out, nil
+}
+
+func (b aliasBackend) DeviceInfo(ctx context.Context, mac string) (BluetoothDevice, error) {
+	d, err := b.Backend.DeviceInfo(ctx, mac)
+	if err != nil {
+		return d, err
+	}
+	return b.aliases.apply(d), nil
+}
+
+// SetAlias drops any local alias once BlueZ holds the name, so the two
+// can't disagree.
+func (b aliasBackend) SetAlias(ctx context.Context, mac, alias string) error {
+	d, err := b.Backend.DeviceInfo(ctx, mac)
+	if err != nil {
+		return err
+	}
+	if d.Paired {
+		err := b.Backend.SetAlias(ctx, mac, alias)
+		if err == nil {
+			return b.aliases.set(mac, "")
+		}
+		if !errors.Is(err, errAliasUnsupported) {
+			return err
+		}
+	}
+	return b.aliases.set(mac, alias)
+}
+
+// Pair hands a locally kept alias to BlueZ once the device is paired, as
+// SetAlias would have had it been paired when renamed. Failing to do so
+// doesn't fail the pairing; the local alias stays in use.
+func (b aliasBackend) Pair(ctx context.Context, mac string) error {
+	if err := b.Backend.Pair(ctx, mac); err != nil {
+		return err
+	}
+	alias, ok := b.aliases.get(mac)
+	if !ok {
+		return nil
+	}
+	if err := b.Backend.SetAlias(ctx, mac, alias); err == nil {
+		_ = b.aliases.set(mac, "")
+	}
+	return nil
+}
+
+// bluezKeepsAlias reports whether renaming d through b reaches BlueZ: the
+// device must be paired, and the backend able to set an alias, which
+// bluetoothctl's can't.
+func bluezKeepsAlias(b Backend, d BluetoothDevice) bool {
+	if w, ok := b.(aliasBackend); ok {
+		b = w.Backend
+	}
+	_, ctl := b.(bluetoothctlBackend)
+	return d.Paired && !ctl
+}
+
+func (b aliasBackend) Discover(ctx context.Context, filter DiscoveryFilter) (<-chan BluetoothDevice, error) {
+	found, err := b.Backend.Discover(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return mapStream(ctx, found, b.aliases.apply), nil
+}
+
+func (b aliasBackend) Events(ctx context.Context) (<-chan Event, error) {
+	events, err := b.Backend.Events(ctx)
+	if err != nil || events == nil {
+		return events, err
+	}
+	return mapStream(ctx, events, func(ev Event) Event {
+		if ev.Kind == EventDeviceAdded || ev.Kind == EventDeviceChanged {
+			ev.Device = b.aliases.apply(ev.Device)
+		}
+		return ev
+	}), nil
+}
+
+func (b aliasBackend) WithAdapter(mac string) Backend {
+	return withAliases(b.Backend.WithAdapter(mac), b.aliases)
+}
+
+// mapStream passes each value from in through f. Once ctx is canceled the
+// rest are dropped, but in is still drained so its sender can finish; the
+// returned channel closes with in.
+func mapStream[T any](ctx context.Context, in <-chan T, f func(T) T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for v := range in {
+			select {
+			case out <- f(v):
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
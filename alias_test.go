@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDisplayName(t *testing.T) {
+	tests := []struct {
+		name   string
+		device BluetoothDevice
+		want   string
+	}{
+		{"no alias", BluetoothDevice{MAC: testMACMouse, Name: "MX Master 3"}, "MX Master 3"},
+		{"alias is the name", BluetoothDevice{MAC: testMACMouse, Name: "MX Master 3", Alias: "MX Master 3"}, "MX Master 3"},
+		{"alias is the address", BluetoothDevice{MAC: testMACMouse, Alias: "11-22-33-44-55-66"}, ""},
+		{"renamed", BluetoothDevice{MAC: testMACMouse, Name: "MX Master 3", Alias: "Work mouse"}, "Work mouse"},
+		{"renamed without a name", BluetoothDevice{MAC: testMACMouse, Alias: "Work mouse"}, "Work mouse"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.device.DisplayName(); got != tc.want {
+				t.Errorf("DisplayName() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAliasBackend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aliases.json")
+	store, err := loadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeBackend()
+	b := withAliases(fake, store)
+	ctx := context.Background()
+
+	// Paired: BlueZ keeps the name.
+	if err := b.SetAlias(ctx, testMACMouse, "Work mouse"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(fake.calls, ",") != "set-alias "+testMACMouse+" Work mouse" {
+		t.Errorf("calls = %v", fake.calls)
+	}
+	if _, ok := store.get(testMACMouse); ok {
+		t.Error("paired device's alias was stored locally")
+	}
+
+	// Unpaired: the name is kept locally and laid over the backend's.
+	fake.calls = nil
+	if err := b.SetAlias(ctx, "22:33:44:55:66:77", "Desk keyboard"); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("unpaired rename reached the backend: %v", fake.calls)
+	}
+	devices, err := b.WithAdapter("5C:F3:70:8B:12:34").ListDevices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := devices[2].DisplayName(); got != "Desk keyboard" {
+		t.Errorf("DisplayName() = %q, want %q", got, "Desk keyboard")
+	}
+	if d, err := matchDevice(devices, "desk"); err != nil || d.MAC != "22:33:44:55:66:77" {
+		t.Errorf("matchDevice by alias = %+v, %v", d, err)
+	}
+
+	// Backends that can't rename fall back to the store too.
+	fake.err = errAliasUnsupported
+	if err := b.SetAlias(ctx, testMACHeadphones, "Headphones"); err != nil {
+		t.Fatal(err)
+	}
+	fake.err = nil
+
+	reloaded, err := loadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for mac, want := range map[string]string{"22:33:44:55:66:77": "Desk keyboard", testMACHeadphones: "Headphones"} {
+		if got, _ := reloaded.get(mac); got != want {
+			t.Errorf("reloaded alias for %s = %q, want %q", mac, got, want)
+		}
+	}
+
+	if err := b.SetAlias(ctx, "22:33:44:55:66:77", ""); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := b.DeviceInfo(ctx, "22:33:44:55:66:77"); d.DisplayName() != "MX Keys" {
+		t.Errorf("DisplayName() after restoring = %q, want %q", d.DisplayName(), "MX Keys")
+	}
+}
+
+func TestAliasBackendPairMovesAlias(t *testing.T) {
+	store, err := loadAliases(filepath.Join(t.TempDir(), "aliases.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const keyboard = "22:33:44:55:66:77"
+	if err := store.set(keyboard, "Desk keyboard"); err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeBackend()
+	b := withAliases(fake, store)
+	ctx := context.Background()
+
+	if err := b.Pair(ctx, keyboard); err != nil {
+		t.Fatal(err)
+	}
+	if want := "pair " + keyboard + ",set-alias " + keyboard + " Desk keyboard"; strings.Join(fake.calls, ",") != want {
+		t.Errorf("calls = %v, want [%s]", fake.calls, want)
+	}
+	if _, ok := store.get(keyboard); ok {
+		t.Error("the alias was kept locally after BlueZ took it")
+	}
+
+	// Without a local alias pairing is all that happens.
+	fake.calls = nil
+	if err := b.Pair(ctx, testMACMouse); err != nil {
+		t.Fatal(err)
+	}
+	if want := "pair " + testMACMouse; strings.Join(fake.calls, ",") != want {
+		t.Errorf("calls = %v, want [%s]", fake.calls, want)
+	}
+}
+
+func TestLoadAliasesMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aliases.json")
+	if err := os.WriteFile(path, []byte(`{"11:22:33:44:55:66": `), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := loadAliases(path)
+	if err == nil {
+		t.Error("expected an error for a malformed file")
+	}
+	if store == nil {
+		t.Fatal("no store to continue with")
+	}
+	if _, ok := store.get(testMACMouse); ok {
+		t.Error("the broken file's aliases were kept")
+	}
+	if err := store.set(testMACMouse, "Work mouse"); err != nil {
+		t.Errorf("set after a malformed file: %v", err)
+	}
+}
+
+func TestAliasBackendDiscover(t *testing.T) {
+	store, err := loadAliases(filepath.Join(t.TempDir(), "aliases.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.set("22:33:44:55:66:77", "Desk keyboard"); err != nil {
+		t.Fatal(err)
+	}
+	devices, err := scanFor(context.Background(), withAliases(newFakeBackend(), store), 10*time.Millisecond, DiscoveryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 3 || devices[2].Alias != "Desk keyboard" {
+		t.Errorf("devices = %+v", devices)
+	}
+}
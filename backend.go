@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	backendAuto         = "auto"
+	backendDBus         = "dbus"
+	backendBluetoothctl = "bluetoothctl"
+)
+
+// Backend is the set of Bluetooth operations the TUI relies on. The
+// bluetoothctl implementation scrapes command output; the D-Bus
+// implementation talks to org.bluez directly.
+type Backend interface {
+	ListDevices(ctx context.Context) ([]BluetoothDevice, error)
+	DeviceInfo(ctx context.Context, mac string) (BluetoothDevice, error)
+	Connect(ctx context.Context, mac string) error
+	Disconnect(ctx context.Context, mac string) error
+	// ConnectProfile and DisconnectProfile act on a single service UUID,
+	// leaving the device's other profiles alone.
+	ConnectProfile(ctx context.Context, mac, uuid string) error
+	DisconnectProfile(ctx context.Context, mac, uuid string) error
+	Pair(ctx context.Context, mac string) error
+	Trust(ctx context.Context, mac string) error
+	Untrust(ctx context.Context, mac string) error
+	// Block disconnects the device and refuses any further connection
+	// from it until Unblock.
+	Block(ctx context.Context, mac string) error
+	Unblock(ctx context.Context, mac string) error
+	// Remove unpairs the device and forgets it.
+	Remove(ctx context.Context, mac string) error
+	// SetAlias renames the device; "" goes back to the name it
+	// advertises.
+	SetAlias(ctx context.Context, mac, alias string) error
+	Powered(ctx context.Context) (bool, error)
+	Power(ctx context.Context, on bool) error
+	// Discover runs device discovery until ctx is canceled, sending each
+	// device as it is found or its advertisement changes. The backend
+	// applies filter except for its Name, which callers check with
+	// Matches. The channel is closed once discovery has stopped.
+	Discover(ctx context.Context, filter DiscoveryFilter) (<-chan BluetoothDevice, error)
+	// Events streams device and adapter changes until ctx is canceled, at
+	// which point the channel is closed.
+	Events(ctx context.Context) (<-chan Event, error)
+	// Adapters lists the controllers, marking the default one.
+	Adapters(ctx context.Context) ([]Adapter, error)
+	// WithAdapter returns a Backend whose operations target the controller
+	// with the given address, or the default controller for "".
+	WithAdapter(mac string) Backend
+	// AdapterInfo describes the selected controller, including the
+	// settings ConfigureAdapter changes.
+	AdapterInfo(ctx context.Context) (Adapter, error)
+	ConfigureAdapter(ctx context.Context, s AdapterSettings) error
+}
+
+// scanFor runs discovery for duration and returns the matching devices it
+// turned up, in the order they were first seen.
+func scanFor(ctx context.Context, b Backend, duration time.Duration, filter DiscoveryFilter) ([]BluetoothDevice, error) {
+	scanCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	found, err := b.Discover(scanCtx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var devices []BluetoothDevice
+	for d := range found {
+		if filter.Matches(d) {
+			devices = upsertDevice(devices, d)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// Adapter is a local Bluetooth controller.
+type Adapter struct {
+	MAC string
+	// Name is the adapter's alias, the name other devices see.
+	Name         string
+	Powered      bool
+	Discoverable bool
+	Pairable     bool
+	// DiscoverableTimeout and PairableTimeout switch the setting off again
+	// after the given time; 0 means never.
+	DiscoverableTimeout time.Duration
+	PairableTimeout     time.Duration
+	// Default is the controller used when none is selected.
+	Default bool
+}
+
+type EventKind int
+
+const (
+	EventDeviceAdded EventKind = iota
+	EventDeviceChanged
+	EventDeviceRemoved
+	EventPowerChanged
+)
+
+// Event is a single incremental update from a backend. Added and changed
+// events carry the device's full current state; removed events only set
+// Device.MAC.
+type Event struct {
+	Kind    EventKind
+	Device  BluetoothDevice
+	Powered bool
+}
+
+// upsertDevice replaces the entry with d's MAC, keeping the known name and
+// alias if d has none, or appends d.
+func upsertDevice(devices []BluetoothDevice, d BluetoothDevice) []BluetoothDevice {
+	for i := range devices {
+		if devices[i].MAC == d.MAC {
+			if d.Name == "" {
+				d.Name = devices[i].Name
+			}
+			if d.Alias == "" {
+				d.Alias = devices[i].Alias
+			}
+			devices[i] = d
+			return devices
+		}
+	}
+	return append(devices, d)
+}
+
+// applyDeviceEvent folds a device event into devices. Power events leave
+// the list untouched.
+func applyDeviceEvent(devices []BluetoothDevice, ev Event) []BluetoothDevice {
+	switch ev.Kind {
+	case EventDeviceAdded, EventDeviceChanged:
+		return upsertDevice(devices, ev.Device)
+	case EventDeviceRemoved:
+		out := make([]BluetoothDevice, 0, len(devices))
+		for _, d := range devices {
+			if d.MAC != ev.Device.MAC {
+				out = append(out, d)
+			}
+		}
+		return out
+	}
+	return devices
+}
+
+// newBackend returns the backend named by cfg.Backend. "auto" prefers
+// D-Bus and falls back to bluetoothctl when bluetoothd isn't reachable on
+// the bus.
+func newBackend(cfg Config) (Backend, error) {
+	ctl := bluetoothctlBackend{concurrency: cfg.InfoConcurrency, commandTimeout: cfg.Timeouts.Command}
+	switch cfg.Backend {
+	case backendBluetoothctl:
+		return ctl, nil
+	case backendDBus:
+		return newDBusBackend(cfg.Timeouts)
+	case backendAuto, "":
+		if b, err := newDBusBackend(cfg.Timeouts); err == nil {
+			return b, nil
+		}
+		return ctl, nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q (want %s, %s or %s)", cfg.Backend, backendAuto, backendDBus, backendBluetoothctl)
+	}
+}
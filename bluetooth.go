@@ -3,11 +3,15 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os/exec"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,13 +22,17 @@ import (
 const (
 	bluetoothYes         = "yes"
 	cmdTimeout           = 15 * time.Second
-	scanCmdTimeout       = 30 * time.Second
+	pairCmdTimeout       = 60 * time.Second
 	scanDuration         = 5 * time.Second
 	postPairConnectDelay = 1 * time.Second
 	infoFetchConcurrency = 4
+	lowBatteryThreshold  = 20
 )
 
-var macRegex = regexp.MustCompile(`^[0-9A-Fa-f]{2}(:[0-9A-Fa-f]{2}){5}$`)
+var (
+	macRegex  = regexp.MustCompile(`^[0-9A-Fa-f]{2}(:[0-9A-Fa-f]{2}){5}$`)
+	ansiRegex = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]|\x01|\x02`)
+)
 
 // runBluetoothctl and runBluetoothctlCombined are overridable to enable testing.
 var runBluetoothctl = func(ctx context.Context, args ...string) ([]byte, error) {
@@ -35,12 +43,65 @@ var runBluetoothctlCombined = func(ctx context.Context, args ...string) ([]byte,
 	return exec.CommandContext(ctx, "bluetoothctl", args...).CombinedOutput()
 }
 
+// runBluetoothctlMonitor runs an interactive bluetoothctl session until ctx
+// is canceled, typing commands into it and passing every output line to
+// onLine. Overridable to enable testing.
+var runBluetoothctlMonitor = func(ctx context.Context, onLine func(string), commands ...string) error {
+	cmd := exec.CommandContext(ctx, "bluetoothctl")
+	// bluetoothctl quits on stdin EOF, so hold the pipe open for the session.
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	defer stdin.Close()
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start bluetoothctl: %w", err)
+	}
+	for _, c := range commands {
+		if _, err := io.WriteString(stdin, c+"\n"); err != nil {
+			return fmt.Errorf("failed to send %q to bluetoothctl: %w", c, err)
+		}
+	}
+	sc := bufio.NewScanner(stdout)
+	for sc.Scan() {
+		onLine(sc.Text())
+	}
+	return cmd.Wait()
+}
+
 type BluetoothDevice struct {
-	MAC       string
-	Name      string
-	Connected bool
-	Paired    bool
-	Trusted   bool
+	MAC  string
+	Name string
+	// Alias is the user-visible name BlueZ uses; it defaults to Name.
+	Alias string
+	// AddressType is "public" or "random" (LE privacy addresses).
+	AddressType   string
+	Connected     bool
+	Paired        bool
+	Bonded        bool
+	Trusted       bool
+	Blocked       bool
+	LegacyPairing bool
+	Modalias      string
+	// Battery is a percentage, only meaningful when HasBattery is set.
+	Battery    int
+	HasBattery bool
+	// RSSI and TxPower are in dBm and only reported while the device is
+	// being discovered.
+	RSSI       int
+	HasRSSI    bool
+	TxPower    int
+	HasTxPower bool
+	// Icon, Class and Appearance describe what the device is; see Category.
+	Icon       string
+	Class      uint32
+	Appearance uint16
+	// UUIDs are the services the device advertises; see deviceProfiles.
+	UUIDs []string
 }
 
 func validateMAC(mac string) error {
@@ -80,20 +141,110 @@ func parseDeviceInfo(b []byte, mac string) BluetoothDevice {
 	sc := bufio.NewScanner(bytes.NewReader(b))
 	for sc.Scan() {
 		line := strings.TrimSpace(sc.Text())
-		switch {
-		case strings.HasPrefix(line, "Name: "):
-			d.Name = strings.TrimPrefix(line, "Name: ")
-		case strings.HasPrefix(line, "Connected: "):
-			d.Connected = strings.TrimPrefix(line, "Connected: ") == bluetoothYes
-		case strings.HasPrefix(line, "Paired: "):
-			d.Paired = strings.TrimPrefix(line, "Paired: ") == bluetoothYes
-		case strings.HasPrefix(line, "Trusted: "):
-			d.Trusted = strings.TrimPrefix(line, "Trusted: ") == bluetoothYes
+		if rest, ok := strings.CutPrefix(line, "Device "); ok {
+			// "Device AA:BB:CC:DD:EE:FF (public)"
+			if _, typ, ok := strings.Cut(rest, "("); ok {
+				d.AddressType = strings.TrimSuffix(typ, ")")
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if set, known := deviceInfoFields[key]; ok && known {
+			set(&d, value)
 		}
 	}
 	return d
 }
 
+// deviceInfoFields fills in a device from each `bluetoothctl info` line,
+// keyed by the text before the colon.
+var deviceInfoFields = map[string]func(d *BluetoothDevice, v string){
+	"Name":          func(d *BluetoothDevice, v string) { d.Name = v },
+	"Alias":         func(d *BluetoothDevice, v string) { d.Alias = v },
+	"Modalias":      func(d *BluetoothDevice, v string) { d.Modalias = v },
+	"Icon":          func(d *BluetoothDevice, v string) { d.Icon = v },
+	"Bonded":        func(d *BluetoothDevice, v string) { d.Bonded = v == bluetoothYes },
+	"LegacyPairing": func(d *BluetoothDevice, v string) { d.LegacyPairing = v == bluetoothYes },
+	"Connected":     func(d *BluetoothDevice, v string) { d.Connected = v == bluetoothYes },
+	"Paired":        func(d *BluetoothDevice, v string) { d.Paired = v == bluetoothYes },
+	"Trusted":       func(d *BluetoothDevice, v string) { d.Trusted = v == bluetoothYes },
+	"Blocked":       func(d *BluetoothDevice, v string) { d.Blocked = v == bluetoothYes },
+	"Battery Percentage": func(d *BluetoothDevice, v string) {
+		d.Battery, d.HasBattery = parseInfoNumber(v)
+	},
+	"RSSI": func(d *BluetoothDevice, v string) {
+		d.RSSI, d.HasRSSI = parseInfoNumber(v)
+	},
+	"TxPower": func(d *BluetoothDevice, v string) {
+		d.TxPower, d.HasTxPower = parseInfoNumber(v)
+	},
+	"Class": func(d *BluetoothDevice, v string) {
+		if class, ok := parseInfoNumber(v); ok {
+			d.Class = uint32(class)
+		}
+	},
+	"Appearance": func(d *BluetoothDevice, v string) {
+		if appearance, ok := parseInfoNumber(v); ok {
+			d.Appearance = uint16(appearance)
+		}
+	},
+	// "UUID: Audio Sink   (0000110b-0000-1000-8000-00805f9b34fb)"
+	"UUID": func(d *BluetoothDevice, v string) {
+		if open := strings.LastIndex(v, "("); open >= 0 && strings.HasSuffix(v, ")") {
+			v = v[open+1 : len(v)-1]
+		}
+		d.UUIDs = append(d.UUIDs, strings.ToLower(strings.TrimSpace(v)))
+	},
+}
+
+// parseInfoNumber reads numeric info values, which bluetoothctl prints
+// either plainly ("-60") or as hex with the decimal in parentheses
+// ("0x4b (75)").
+func parseInfoNumber(v string) (int, bool) {
+	if open := strings.LastIndex(v, "("); open >= 0 && strings.HasSuffix(v, ")") {
+		v = v[open+1 : len(v)-1]
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 0, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// monitorLine is one [NEW]/[CHG]/[DEL] notification from an interactive
+// bluetoothctl session, e.g. "[CHG] Device AA:BB:CC:DD:EE:FF Connected: no".
+type monitorLine struct {
+	tag    string // NEW, CHG or DEL
+	object string // Device or Controller
+	mac    string
+	key    string
+	value  string
+}
+
+func parseMonitorLine(line string) (monitorLine, bool) {
+	line = strings.ReplaceAll(ansiRegex.ReplaceAllString(line, ""), "\r", "")
+	var ml monitorLine
+	for _, tag := range []string{"NEW", "CHG", "DEL"} {
+		if i := strings.Index(line, "["+tag+"] "); i >= 0 {
+			ml.tag = tag
+			line = line[i+len(tag)+3:]
+			break
+		}
+	}
+	if ml.tag == "" {
+		return ml, false
+	}
+	parts := strings.SplitN(strings.TrimSpace(line), " ", 3)
+	if len(parts) < 2 || (parts[0] != "Device" && parts[0] != "Controller") || !macRegex.MatchString(parts[1]) {
+		return ml, false
+	}
+	ml.object, ml.mac = parts[0], parts[1]
+	if ml.tag == "CHG" && len(parts) == 3 {
+		ml.key, ml.value, _ = strings.Cut(parts[2], ": ")
+	}
+	return ml, true
+}
+
 func parsePoweredStatus(b []byte) (bool, error) {
 	sc := bufio.NewScanner(bytes.NewReader(b))
 	for sc.Scan() {
@@ -116,14 +267,14 @@ func getDeviceInfo(ctx context.Context, mac string) (BluetoothDevice, error) {
 	return parseDeviceInfo(output, mac), nil
 }
 
-func getDevices(ctx context.Context) ([]BluetoothDevice, error) {
+func getDevices(ctx context.Context, concurrency int) ([]BluetoothDevice, error) {
 	output, err := runBluetoothctl(ctx, "devices")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list devices: %w", err)
 	}
 	devices := parseDevicesOutput(output)
 
-	sem := make(chan struct{}, infoFetchConcurrency)
+	sem := make(chan struct{}, concurrency)
 	var wg sync.WaitGroup
 	for i := range devices {
 		wg.Add(1)
@@ -136,43 +287,16 @@ func getDevices(ctx context.Context) ([]BluetoothDevice, error) {
 			if err != nil {
 				return
 			}
-			if info.Name != "" {
-				devices[i].Name = info.Name
+			if info.Name == "" {
+				info.Name = devices[i].Name
 			}
-			devices[i].Connected = info.Connected
-			devices[i].Paired = info.Paired
-			devices[i].Trusted = info.Trusted
+			devices[i] = info
 		}(i)
 	}
 	wg.Wait()
 	return devices, nil
 }
 
-// scanDevices toggles discovery on, waits, then toggles it off. The "off"
-// is always attempted even if the wait is canceled.
-func scanDevices(ctx context.Context) ([]BluetoothDevice, error) {
-	startCtx, cancelStart := context.WithTimeout(ctx, cmdTimeout)
-	defer cancelStart()
-	if output, err := runBluetoothctlCombined(startCtx, "scan", "on"); err != nil {
-		return nil, fmt.Errorf("failed to start scan: %w, output: %s", err, string(output))
-	}
-
-	defer func() {
-		// Use Background so we still stop scanning if the outer context is canceled.
-		stopCtx, cancelStop := context.WithTimeout(context.Background(), cmdTimeout)
-		defer cancelStop()
-		_, _ = runBluetoothctlCombined(stopCtx, "scan", "off")
-	}()
-
-	select {
-	case <-time.After(scanDuration):
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	}
-
-	return getDevices(ctx)
-}
-
 func connectDevice(ctx context.Context, mac string) error {
 	if err := validateMAC(mac); err != nil {
 		return err
@@ -195,6 +319,28 @@ func disconnectDevice(ctx context.Context, mac string) error {
 	return nil
 }
 
+func connectProfile(ctx context.Context, mac, uuid string) error {
+	if err := validateMAC(mac); err != nil {
+		return err
+	}
+	output, err := runBluetoothctlCombined(ctx, "connect", mac, uuid)
+	if err != nil {
+		return fmt.Errorf("failed to connect profile %s on device %s: %w, output: %s", uuid, mac, err, string(output))
+	}
+	return nil
+}
+
+func disconnectProfile(ctx context.Context, mac, uuid string) error {
+	if err := validateMAC(mac); err != nil {
+		return err
+	}
+	output, err := runBluetoothctlCombined(ctx, "disconnect", mac, uuid)
+	if err != nil {
+		return fmt.Errorf("failed to disconnect profile %s on device %s: %w, output: %s", uuid, mac, err, string(output))
+	}
+	return nil
+}
+
 func pairDevice(ctx context.Context, mac string) error {
 	if err := validateMAC(mac); err != nil {
 		return err
@@ -217,6 +363,50 @@ func trustDevice(ctx context.Context, mac string) error {
 	return nil
 }
 
+func untrustDevice(ctx context.Context, mac string) error {
+	if err := validateMAC(mac); err != nil {
+		return err
+	}
+	output, err := runBluetoothctlCombined(ctx, "untrust", mac)
+	if err != nil {
+		return fmt.Errorf("failed to untrust device %s: %w, output: %s", mac, err, string(output))
+	}
+	return nil
+}
+
+func blockDevice(ctx context.Context, mac string) error {
+	if err := validateMAC(mac); err != nil {
+		return err
+	}
+	output, err := runBluetoothctlCombined(ctx, "block", mac)
+	if err != nil {
+		return fmt.Errorf("failed to block device %s: %w, output: %s", mac, err, string(output))
+	}
+	return nil
+}
+
+func unblockDevice(ctx context.Context, mac string) error {
+	if err := validateMAC(mac); err != nil {
+		return err
+	}
+	output, err := runBluetoothctlCombined(ctx, "unblock", mac)
+	if err != nil {
+		return fmt.Errorf("failed to unblock device %s: %w, output: %s", mac, err, string(output))
+	}
+	return nil
+}
+
+func removeDevice(ctx context.Context, mac string) error {
+	if err := validateMAC(mac); err != nil {
+		return err
+	}
+	output, err := runBluetoothctlCombined(ctx, "remove", mac)
+	if err != nil {
+		return fmt.Errorf("failed to remove device %s: %w, output: %s", mac, err, string(output))
+	}
+	return nil
+}
+
 func isBluetoothEnabled(ctx context.Context) (bool, error) {
 	output, err := runBluetoothctl(ctx, "show")
 	if err != nil {
@@ -225,6 +415,92 @@ func isBluetoothEnabled(ctx context.Context) (bool, error) {
 	return parsePoweredStatus(output)
 }
 
+// parseAdaptersOutput reads `bluetoothctl list`, e.g.
+// "Controller 00:1A:7D:DA:71:13 laptop [default]".
+func parseAdaptersOutput(b []byte) []Adapter {
+	var out []Adapter
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(ansiRegex.ReplaceAllString(sc.Text(), "")), " ", 3)
+		if len(parts) < 2 || parts[0] != "Controller" || !macRegex.MatchString(parts[1]) {
+			continue
+		}
+		a := Adapter{MAC: parts[1]}
+		if len(parts) > 2 {
+			name, isDefault := strings.CutSuffix(parts[2], " [default]")
+			a.Name, a.Default = name, isDefault
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+func listAdapters(ctx context.Context) ([]Adapter, error) {
+	output, err := runBluetoothctl(ctx, "list")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list adapters: %w", err)
+	}
+	adapters := parseAdaptersOutput(output)
+	for i := range adapters {
+		output, err := runBluetoothctl(ctx, "show", adapters[i].MAC)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get adapter %s status: %w", adapters[i].MAC, err)
+		}
+		info := parseAdapterInfo(output)
+		info.MAC, info.Name, info.Default = adapters[i].MAC, adapters[i].Name, adapters[i].Default
+		adapters[i] = info
+	}
+	return adapters, nil
+}
+
+// parseAdapterInfo reads `bluetoothctl show`. Timeouts are printed in hex,
+// e.g. "DiscoverableTimeout: 0x000000b4 (180)" on newer versions.
+func parseAdapterInfo(b []byte) Adapter {
+	var a Adapter
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimSpace(ansiRegex.ReplaceAllString(sc.Text(), ""))
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "Controller" && macRegex.MatchString(fields[1]) {
+				a.MAC = fields[1]
+			}
+			continue
+		}
+		switch key {
+		case "Name":
+			if a.Name == "" {
+				a.Name = value
+			}
+		case "Alias":
+			a.Name = value
+		case "Powered":
+			a.Powered = value == bluetoothYes
+		case "Discoverable":
+			a.Discoverable = value == bluetoothYes
+		case "Pairable":
+			a.Pairable = value == bluetoothYes
+		case "DiscoverableTimeout":
+			a.DiscoverableTimeout = parseTimeoutField(value)
+		case "PairableTimeout":
+			a.PairableTimeout = parseTimeoutField(value)
+		}
+	}
+	return a
+}
+
+func parseTimeoutField(value string) time.Duration {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0
+	}
+	n, err := strconv.ParseUint(fields[0], 0, 32)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
 func enableBluetooth(ctx context.Context) error {
 	output, err := runBluetoothctlCombined(ctx, "power", "on")
 	if err != nil {
@@ -241,128 +517,727 @@ func disableBluetooth(ctx context.Context) error {
 	return nil
 }
 
+// bluetoothctlBackend implements Backend by shelling out to bluetoothctl.
+// It only supports the default controller: bluetoothctl's select command
+// lasts for one interactive session, and every one-shot command starts a
+// new one on the default controller. Selecting any other adapter makes
+// every operation fail with errAdapterUnreachable rather than silently use
+// the wrong radio; the D-Bus backend can address each adapter.
+type bluetoothctlBackend struct {
+	adapter string
+	// controller caches the default controller's address for route; it is
+	// set by WithAdapter.
+	controller *defaultController
+	// concurrency caps the info queries made while listing devices; 0
+	// means infoFetchConcurrency.
+	concurrency int
+	// commandTimeout bounds each info lookup made from a monitor session;
+	// 0 means cmdTimeout.
+	commandTimeout time.Duration
+}
+
+var errAdapterUnreachable = errors.New("bluetoothctl only supports the default controller; use --backend dbus to select another adapter")
+
+// defaultController remembers which controller bluetoothctl defaults to,
+// so route doesn't list the adapters before every operation. Failed
+// lookups aren't cached.
+type defaultController struct {
+	mu  sync.Mutex
+	mac string
+}
+
+func (c *defaultController) get(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mac != "" {
+		return c.mac, nil
+	}
+	output, err := runBluetoothctl(ctx, "list")
+	if err != nil {
+		return "", fmt.Errorf("failed to list adapters: %w", err)
+	}
+	for _, a := range parseAdaptersOutput(output) {
+		if a.Default {
+			c.mac = a.MAC
+			return c.mac, nil
+		}
+	}
+	return "", errors.New("no default controller")
+}
+
+// adapterReachable reports whether b can use a: the bluetoothctl backend
+// only reaches the default controller.
+func adapterReachable(b Backend, a Adapter) bool {
+	if w, ok := b.(aliasBackend); ok {
+		b = w.Backend
+	}
+	_, ctl := b.(bluetoothctlBackend)
+	return a.Default || !ctl
+}
+
+// route checks that the selected adapter is still the one bluetoothctl
+// talks to; selectAdapter and the TUI only pick reachable adapters, but
+// the default controller can change while running.
+func (b bluetoothctlBackend) route(ctx context.Context) error {
+	if b.adapter == "" || b.controller == nil {
+		return nil
+	}
+	mac, err := b.controller.get(ctx)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(mac, b.adapter) {
+		return fmt.Errorf("%w (%s)", errAdapterUnreachable, b.adapter)
+	}
+	return nil
+}
+
+func (bluetoothctlBackend) Adapters(ctx context.Context) ([]Adapter, error) {
+	return listAdapters(ctx)
+}
+
+func (b bluetoothctlBackend) WithAdapter(mac string) Backend {
+	b.adapter, b.controller = mac, &defaultController{}
+	return b
+}
+
+func (b bluetoothctlBackend) AdapterInfo(ctx context.Context) (Adapter, error) {
+	if err := b.route(ctx); err != nil {
+		return Adapter{}, err
+	}
+	output, err := runBluetoothctl(ctx, "show")
+	if err != nil {
+		return Adapter{}, fmt.Errorf("failed to get adapter info: %w", err)
+	}
+	a := parseAdapterInfo(output)
+	if a.MAC == "" {
+		return Adapter{}, errors.New("no bluetooth adapter found")
+	}
+	a.Default = true
+	return a, nil
+}
+
+// errPairableTimeout is returned because bluetoothctl has no command for
+// the PairableTimeout property.
+var errPairableTimeout = errors.New("bluetoothctl cannot set the pairable timeout; use --backend dbus")
+
+// ConfigureAdapter applies the timeouts before switching discoverable or
+// pairable on, so the new timeout covers this window.
+func (b bluetoothctlBackend) ConfigureAdapter(ctx context.Context, s AdapterSettings) error {
+	if s.PairableTimeout != nil {
+		return errPairableTimeout
+	}
+	if err := b.route(ctx); err != nil {
+		return err
+	}
+	var cmds [][]string
+	if s.Alias != nil {
+		cmds = append(cmds, []string{"system-alias", *s.Alias})
+	}
+	if s.Pairable != nil {
+		cmds = append(cmds, []string{"pairable", onOff(*s.Pairable)})
+	}
+	if s.DiscoverableTimeout != nil {
+		cmds = append(cmds, []string{"discoverable-timeout", strconv.Itoa(int(*s.DiscoverableTimeout / time.Second))})
+	}
+	if s.Discoverable != nil {
+		cmds = append(cmds, []string{"discoverable", onOff(*s.Discoverable)})
+	}
+	for _, args := range cmds {
+		output, err := runBluetoothctlCombined(ctx, args...)
+		if err != nil {
+			return fmt.Errorf("failed to set adapter %s: %w, output: %s", args[0], err, string(output))
+		}
+	}
+	return nil
+}
+
+func (b bluetoothctlBackend) ListDevices(ctx context.Context) ([]BluetoothDevice, error) {
+	if err := b.route(ctx); err != nil {
+		return nil, err
+	}
+	return getDevices(ctx, cmp.Or(b.concurrency, infoFetchConcurrency))
+}
+
+func (b bluetoothctlBackend) DeviceInfo(ctx context.Context, mac string) (BluetoothDevice, error) {
+	if err := b.route(ctx); err != nil {
+		return BluetoothDevice{}, err
+	}
+	return getDeviceInfo(ctx, mac)
+}
+
+func (b bluetoothctlBackend) Connect(ctx context.Context, mac string) error {
+	if err := b.route(ctx); err != nil {
+		return err
+	}
+	return connectDevice(ctx, mac)
+}
+
+func (b bluetoothctlBackend) Disconnect(ctx context.Context, mac string) error {
+	if err := b.route(ctx); err != nil {
+		return err
+	}
+	return disconnectDevice(ctx, mac)
+}
+
+func (b bluetoothctlBackend) ConnectProfile(ctx context.Context, mac, uuid string) error {
+	if err := b.route(ctx); err != nil {
+		return err
+	}
+	return connectProfile(ctx, mac, uuid)
+}
+
+func (b bluetoothctlBackend) DisconnectProfile(ctx context.Context, mac, uuid string) error {
+	if err := b.route(ctx); err != nil {
+		return err
+	}
+	return disconnectProfile(ctx, mac, uuid)
+}
+
+func (b bluetoothctlBackend) Pair(ctx context.Context, mac string) error {
+	if err := b.route(ctx); err != nil {
+		return err
+	}
+	return pairDevice(ctx, mac)
+}
+
+func (b bluetoothctlBackend) Trust(ctx context.Context, mac string) error {
+	if err := b.route(ctx); err != nil {
+		return err
+	}
+	return trustDevice(ctx, mac)
+}
+
+func (b bluetoothctlBackend) Untrust(ctx context.Context, mac string) error {
+	if err := b.route(ctx); err != nil {
+		return err
+	}
+	return untrustDevice(ctx, mac)
+}
+
+func (b bluetoothctlBackend) Block(ctx context.Context, mac string) error {
+	if err := b.route(ctx); err != nil {
+		return err
+	}
+	return blockDevice(ctx, mac)
+}
+
+func (b bluetoothctlBackend) Unblock(ctx context.Context, mac string) error {
+	if err := b.route(ctx); err != nil {
+		return err
+	}
+	return unblockDevice(ctx, mac)
+}
+
+func (b bluetoothctlBackend) Remove(ctx context.Context, mac string) error {
+	if err := b.route(ctx); err != nil {
+		return err
+	}
+	return removeDevice(ctx, mac)
+}
+
+// errAliasUnsupported is returned because bluetoothctl's set-alias only
+// renames the device it connected to in the same session.
+var errAliasUnsupported = errors.New("bluetoothctl cannot rename a device; use --backend dbus")
+
+func (bluetoothctlBackend) SetAlias(context.Context, string, string) error {
+	return errAliasUnsupported
+}
+
+func (b bluetoothctlBackend) Powered(ctx context.Context) (bool, error) {
+	if err := b.route(ctx); err != nil {
+		return false, err
+	}
+	return isBluetoothEnabled(ctx)
+}
+
+func (b bluetoothctlBackend) Power(ctx context.Context, on bool) error {
+	if err := b.route(ctx); err != nil {
+		return err
+	}
+	if on {
+		return enableBluetooth(ctx)
+	}
+	return disableBluetooth(ctx)
+}
+
+// Discover types the filter and "scan on" into an interactive session.
+// BlueZ ties discovery to the client that started it, so ending the session
+// when ctx is canceled also stops the scan.
+func (b bluetoothctlBackend) Discover(ctx context.Context, filter DiscoveryFilter) (<-chan BluetoothDevice, error) {
+	if err := b.route(ctx); err != nil {
+		return nil, err
+	}
+	out := make(chan BluetoothDevice)
+	go func() {
+		defer close(out)
+		tracker := newDeviceTracker(cmp.Or(b.commandTimeout, cmdTimeout))
+		_ = runBluetoothctlMonitor(ctx, func(line string) {
+			ml, ok := parseMonitorLine(line)
+			if !ok || ml.object != "Device" || ml.tag == "DEL" {
+				return
+			}
+			ev, ok := tracker.event(ctx, ml)
+			if !ok {
+				return
+			}
+			select {
+			case out <- ev.Device:
+			case <-ctx.Done():
+			}
+		}, append(scanMenuCommands(filter), "scan on")...)
+	}()
+	return out, nil
+}
+
+// scanMenuCommands sets filter through bluetoothctl's scan submenu,
+// clearing whatever an earlier session set first.
+func scanMenuCommands(f DiscoveryFilter) []string {
+	cmds := []string{"menu scan", "clear"}
+	if f.Transport != "" {
+		cmds = append(cmds, "transport "+f.Transport)
+	}
+	if f.MinRSSI != 0 {
+		cmds = append(cmds, "rssi "+strconv.Itoa(f.MinRSSI))
+	}
+	if f.Pathloss != 0 {
+		cmds = append(cmds, "pathloss "+strconv.Itoa(f.Pathloss))
+	}
+	if len(f.UUIDs) > 0 {
+		cmds = append(cmds, "uuids "+strings.Join(f.UUIDs, " "))
+	}
+	if f.DuplicateData != nil {
+		cmds = append(cmds, "duplicate-data "+onOff(*f.DuplicateData))
+	}
+	return append(cmds, "back")
+}
+
+// Events follows an interactive bluetoothctl session. Every event carries
+// full device state; see deviceTracker.
+func (b bluetoothctlBackend) Events(ctx context.Context) (<-chan Event, error) {
+	if err := b.route(ctx); err != nil {
+		return nil, err
+	}
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		tracker := newDeviceTracker(cmp.Or(b.commandTimeout, cmdTimeout))
+		_ = runBluetoothctlMonitor(ctx, func(line string) {
+			ml, ok := parseMonitorLine(line)
+			if !ok {
+				return
+			}
+			ev, ok := tracker.event(ctx, ml)
+			if !ok {
+				return
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return out, nil
+}
+
+// deviceTracker remembers the devices a monitor session has looked up.
+// While scanning, BlueZ reports a change for every advertisement, so
+// those are applied to the known device rather than each costing an info
+// lookup; new devices and other changes are looked up in full.
+type deviceTracker struct {
+	devices map[string]BluetoothDevice
+	timeout time.Duration
+}
+
+func newDeviceTracker(timeout time.Duration) *deviceTracker {
+	return &deviceTracker{devices: map[string]BluetoothDevice{}, timeout: timeout}
+}
+
+// advertisementKeys are the properties that change with every
+// advertisement. Those without a field in BluetoothDevice produce no
+// event once the device is known.
+var advertisementKeys = []string{"RSSI", "TxPower", "ManufacturerData", "ServiceData", "AdvertisingData", "AdvertisingFlags"}
+
+func (t *deviceTracker) event(ctx context.Context, ml monitorLine) (Event, bool) {
+	if ml.object == "Controller" {
+		if ml.tag == "CHG" && ml.key == "Powered" {
+			return Event{Kind: EventPowerChanged, Powered: ml.value == bluetoothYes}, true
+		}
+		return Event{}, false
+	}
+	if ml.tag == "DEL" {
+		delete(t.devices, ml.mac)
+		return Event{Kind: EventDeviceRemoved, Device: BluetoothDevice{MAC: ml.mac}}, true
+	}
+	if d, known := t.devices[ml.mac]; known && ml.tag == "CHG" {
+		if key, _, _ := strings.Cut(ml.key, " "); slices.Contains(advertisementKeys, key) {
+			if !applyAdvertisement(&d, key, ml) {
+				return Event{}, false
+			}
+			t.devices[ml.mac] = d
+			return Event{Kind: EventDeviceChanged, Device: d}, true
+		}
+	}
+	infoCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	d, err := getDeviceInfo(infoCtx, ml.mac)
+	if err != nil {
+		return Event{}, false
+	}
+	t.devices[ml.mac] = d
+	kind := EventDeviceChanged
+	if ml.tag == "NEW" {
+		kind = EventDeviceAdded
+	}
+	return Event{Kind: kind, Device: d}, true
+}
+
+// applyAdvertisement updates d's signal readings from a change to key,
+// reporting whether anything BluetoothDevice holds changed. BlueZ prints
+// "RSSI is nil" once the device goes out of range or discovery stops.
+func applyAdvertisement(d *BluetoothDevice, key string, ml monitorLine) bool {
+	if strings.HasSuffix(ml.key, " is nil") {
+		switch key {
+		case "RSSI":
+			d.RSSI, d.HasRSSI = 0, false
+		case "TxPower":
+			d.TxPower, d.HasTxPower = 0, false
+		default:
+			return false
+		}
+		return true
+	}
+	n, ok := parseInfoNumber(ml.value)
+	switch {
+	case key == "RSSI" && ok:
+		d.RSSI, d.HasRSSI = n, true
+	case key == "TxPower" && ok:
+		d.TxPower, d.HasTxPower = n, true
+	default:
+		return false
+	}
+	return true
+}
+
 // Bubble Tea command factories
 
-func getDevicesCmd() tea.Cmd {
+func getDevicesCmd(b Backend, t Timeouts, adapter string) tea.Cmd {
 	return func() tea.Msg {
-		ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), t.Command)
 		defer cancel()
-		devices, err := getDevices(ctx)
+		devices, err := b.ListDevices(ctx)
 		if err != nil {
 			return errorMsg{err: err}
 		}
-		return devicesMsg{devices: devices}
+		return devicesMsg{adapter: adapter, devices: devices}
 	}
 }
 
-func scanDevicesCmd() tea.Cmd {
+// startScanCmd starts discovery that runs for duration, or until canceled
+// if duration is 0. seq identifies the scan the result belongs to.
+func startScanCmd(b Backend, duration time.Duration, filter DiscoveryFilter, seq int) tea.Cmd {
 	return func() tea.Msg {
-		ctx, cancel := context.WithTimeout(context.Background(), scanCmdTimeout)
-		defer cancel()
-		devices, err := scanDevices(ctx)
+		ctx, cancel := scanContext(duration)
+		found, err := b.Discover(ctx, filter)
 		if err != nil {
-			return scanCompleteMsg{err: err}
+			cancel()
+			return scanStartedMsg{seq: seq, err: err}
 		}
-		return scanCompleteMsg{devices: devices}
+		return scanStartedMsg{seq: seq, found: found, cancel: cancel}
 	}
 }
 
-func connectDeviceCmd(mac string) tea.Cmd {
+func scanContext(duration time.Duration) (context.Context, context.CancelFunc) {
+	if duration > 0 {
+		return context.WithTimeout(context.Background(), duration)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func waitForScanDeviceCmd(found <-chan BluetoothDevice) tea.Cmd {
 	return func() tea.Msg {
-		ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
+		d, ok := <-found
+		if !ok {
+			return scanStoppedMsg{found: found}
+		}
+		return scanDeviceMsg{device: d, found: found}
+	}
+}
+
+// scanTickCmd redraws the scanning banner's elapsed time every second.
+func scanTickCmd(found <-chan BluetoothDevice) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return scanTickMsg{found: found}
+	})
+}
+
+func connectDeviceCmd(b Backend, t Timeouts, mac string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), t.Command)
 		defer cancel()
-		if err := connectDevice(ctx, mac); err != nil {
+		if err := b.Connect(ctx, mac); err != nil {
 			return errorMsg{err: err}
 		}
 		return deviceStatusMsg{deviceMAC: mac, connected: true}
 	}
 }
 
-func disconnectDeviceCmd(mac string) tea.Cmd {
+func disconnectDeviceCmd(b Backend, t Timeouts, mac string) tea.Cmd {
 	return func() tea.Msg {
-		ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), t.Command)
 		defer cancel()
-		if err := disconnectDevice(ctx, mac); err != nil {
+		if err := b.Disconnect(ctx, mac); err != nil {
 			return errorMsg{err: err}
 		}
 		return deviceStatusMsg{deviceMAC: mac, connected: false}
 	}
 }
 
-func pairDeviceCmd(mac string) tea.Cmd {
+func pairDeviceCmd(b Backend, t Timeouts, mac string) tea.Cmd {
 	return func() tea.Msg {
-		ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
+		// Long enough for the user to answer pairing agent prompts.
+		ctx, cancel := context.WithTimeout(context.Background(), t.Pair)
 		defer cancel()
-		if err := pairDevice(ctx, mac); err != nil {
+		if err := b.Pair(ctx, mac); err != nil {
 			return errorMsg{err: err}
 		}
-		if err := trustDevice(ctx, mac); err != nil {
+		if err := b.Trust(ctx, mac); err != nil {
 			return errorMsg{err: fmt.Errorf("paired but failed to trust: %w", err)}
 		}
-		devices, err := getDevices(ctx)
+		device, err := b.DeviceInfo(ctx, mac)
 		if err != nil {
 			return errorMsg{err: err}
 		}
-		return devicesMsg{devices: devices}
+		return deviceUpdatedMsg{device: device}
 	}
 }
 
-func pairAndConnectDeviceCmd(mac string) tea.Cmd {
+func pairAndConnectDeviceCmd(b Backend, t Timeouts, mac string) tea.Cmd {
 	return func() tea.Msg {
-		ctx, cancel := context.WithTimeout(context.Background(), scanCmdTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), t.Pair)
 		defer cancel()
-		if err := pairDevice(ctx, mac); err != nil {
+		if err := b.Pair(ctx, mac); err != nil {
 			return errorMsg{err: err}
 		}
-		if err := trustDevice(ctx, mac); err != nil {
+		if err := b.Trust(ctx, mac); err != nil {
 			return errorMsg{err: fmt.Errorf("paired but failed to trust: %w", err)}
 		}
 		select {
-		case <-time.After(postPairConnectDelay):
+		case <-time.After(t.PostPairConnect):
 		case <-ctx.Done():
 			return errorMsg{err: ctx.Err()}
 		}
-		if err := connectDevice(ctx, mac); err != nil {
+		if err := b.Connect(ctx, mac); err != nil {
 			return errorMsg{err: fmt.Errorf("paired but failed to connect: %w", err)}
 		}
-		devices, err := getDevices(ctx)
+		device, err := b.DeviceInfo(ctx, mac)
 		if err != nil {
 			return errorMsg{err: err}
 		}
-		return devicesMsg{devices: devices}
+		return deviceUpdatedMsg{device: device}
 	}
 }
 
-func getBluetoothStatusCmd() tea.Cmd {
+// deviceOpCmd runs a single-device operation and reports the device's
+// resulting state.
+func deviceOpCmd(b Backend, t Timeouts, mac string, op func(context.Context, string) error) tea.Cmd {
 	return func() tea.Msg {
-		ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), t.Command)
 		defer cancel()
-		enabled, err := isBluetoothEnabled(ctx)
+		if err := op(ctx, mac); err != nil {
+			return errorMsg{err: err}
+		}
+		device, err := b.DeviceInfo(ctx, mac)
 		if err != nil {
-			return bluetoothStatusMsg{enabled: false, err: err}
+			return errorMsg{err: err}
 		}
-		return bluetoothStatusMsg{enabled: enabled}
+		return deviceUpdatedMsg{device: device}
 	}
 }
 
-func enableBluetoothCmd() tea.Cmd {
+func trustDeviceCmd(b Backend, t Timeouts, mac string) tea.Cmd {
+	return deviceOpCmd(b, t, mac, b.Trust)
+}
+
+func untrustDeviceCmd(b Backend, t Timeouts, mac string) tea.Cmd {
+	return deviceOpCmd(b, t, mac, b.Untrust)
+}
+
+func blockDeviceCmd(b Backend, t Timeouts, mac string) tea.Cmd {
+	return deviceOpCmd(b, t, mac, b.Block)
+}
+
+func unblockDeviceCmd(b Backend, t Timeouts, mac string) tea.Cmd {
+	return deviceOpCmd(b, t, mac, b.Unblock)
+}
+
+func setAliasCmd(b Backend, t Timeouts, mac, alias string) tea.Cmd {
+	return deviceOpCmd(b, t, mac, func(ctx context.Context, mac string) error {
+		return b.SetAlias(ctx, mac, alias)
+	})
+}
+
+func connectProfileCmd(b Backend, t Timeouts, mac, uuid string) tea.Cmd {
+	return deviceOpCmd(b, t, mac, func(ctx context.Context, mac string) error {
+		return b.ConnectProfile(ctx, mac, uuid)
+	})
+}
+
+func disconnectProfileCmd(b Backend, t Timeouts, mac, uuid string) tea.Cmd {
+	return deviceOpCmd(b, t, mac, func(ctx context.Context, mac string) error {
+		return b.DisconnectProfile(ctx, mac, uuid)
+	})
+}
+
+func removeDeviceCmd(b Backend, t Timeouts, mac string) tea.Cmd {
 	return func() tea.Msg {
-		ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), t.Command)
 		defer cancel()
-		if err := enableBluetooth(ctx); err != nil {
+		if err := b.Remove(ctx, mac); err != nil {
 			return errorMsg{err: err}
 		}
-		return bluetoothStatusMsg{enabled: true}
+		return deviceRemovedMsg{deviceMAC: mac}
 	}
 }
 
-func disableBluetoothCmd() tea.Cmd {
+func getBluetoothStatusCmd(b Backend, t Timeouts, adapter string) tea.Cmd {
 	return func() tea.Msg {
-		ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), t.Command)
 		defer cancel()
-		if err := disableBluetooth(ctx); err != nil {
+		enabled, err := b.Powered(ctx)
+		if err != nil {
+			return bluetoothStatusMsg{adapter: adapter, enabled: false, err: err}
+		}
+		return bluetoothStatusMsg{adapter: adapter, enabled: enabled}
+	}
+}
+
+func enableBluetoothCmd(b Backend, t Timeouts, adapter string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), t.Command)
+		defer cancel()
+		if err := b.Power(ctx, true); err != nil {
+			return errorMsg{err: err}
+		}
+		return bluetoothStatusMsg{adapter: adapter, enabled: true}
+	}
+}
+
+func disableBluetoothCmd(b Backend, t Timeouts, adapter string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), t.Command)
+		defer cancel()
+		if err := b.Power(ctx, false); err != nil {
 			return errorMsg{err: err}
 		}
-		return bluetoothStatusMsg{enabled: false}
+		return bluetoothStatusMsg{adapter: adapter, enabled: false}
+	}
+}
+
+// subscribeEventsCmd starts a subscription that lasts until the returned
+// cancel func is called, e.g. when switching adapters.
+func subscribeEventsCmd(b Backend, adapter string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithCancel(context.Background())
+		events, err := b.Events(ctx)
+		if err != nil {
+			cancel()
+			return eventsSubscribedMsg{adapter: adapter, err: err}
+		}
+		return eventsSubscribedMsg{adapter: adapter, events: events, cancel: cancel}
+	}
+}
+
+func waitForEventCmd(events <-chan Event) tea.Cmd {
+	return func() tea.Msg {
+		ev, ok := <-events
+		if !ok {
+			return eventStreamClosedMsg{events: events}
+		}
+		return backendEventMsg{event: ev, events: events}
 	}
 }
+
+func listAdaptersCmd(b Backend, t Timeouts) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), t.Command)
+		defer cancel()
+		adapters, err := b.Adapters(ctx)
+		if err != nil {
+			return errorMsg{err: err}
+		}
+		return adaptersMsg{adapters: adapters}
+	}
+}
+
+func saveStateCmd(path string, state uiState) tea.Cmd {
+	if path == "" {
+		return nil
+	}
+	return func() tea.Msg {
+		if err := saveState(path, state); err != nil {
+			return errorMsg{err: err}
+		}
+		return nil
+	}
+}
+
+func adapterInfoCmd(b Backend, t Timeouts) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), t.Command)
+		defer cancel()
+		adapter, err := b.AdapterInfo(ctx)
+		if err != nil {
+			return errorMsg{err: err}
+		}
+		return adapterInfoMsg{adapter: adapter}
+	}
+}
+
+func configureAdapterCmd(b Backend, t Timeouts, s AdapterSettings) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), t.Command)
+		defer cancel()
+		if err := b.ConfigureAdapter(ctx, s); err != nil {
+			return errorMsg{err: err}
+		}
+		adapter, err := b.AdapterInfo(ctx)
+		if err != nil {
+			return errorMsg{err: err}
+		}
+		return adapterInfoMsg{adapter: adapter}
+	}
+}
+
+// registerAgentCmd returns nil for backends without their own agent; those
+// rely on whatever agent bluetoothd already has. The alias layer is looked
+// through, since it has no agent of its own.
+func registerAgentCmd(b Backend) tea.Cmd {
+	if w, ok := b.(aliasBackend); ok {
+		b = w.Backend
+	}
+	agent, ok := b.(PairingAgent)
+	if !ok {
+		return nil
+	}
+	return func() tea.Msg {
+		requests, err := agent.RegisterAgent(context.Background())
+		return agentRegisteredMsg{requests: requests, err: err}
+	}
+}
+
+func waitForPairingRequestCmd(requests <-chan *PairingRequest) tea.Cmd {
+	return func() tea.Msg {
+		req, ok := <-requests
+		if !ok {
+			return nil
+		}
+		return pairingRequestMsg{request: req}
+	}
+}
+
+func pairingTickCmd(seq int) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return pairingTickMsg{seq: seq}
+	})
+}
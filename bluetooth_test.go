@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"errors"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -78,7 +80,7 @@ func TestParseDevicesOutput(t *testing.T) {
 				t.Fatalf("got %d devices, want %d: %+v", len(got), len(tc.want), got)
 			}
 			for i := range got {
-				if got[i] != tc.want[i] {
+				if !reflect.DeepEqual(got[i], tc.want[i]) {
 					t.Errorf("device %d: got %+v, want %+v", i, got[i], tc.want[i])
 				}
 			}
@@ -114,6 +116,93 @@ func TestParseDeviceInfo(t *testing.T) {
 	if !d.Trusted {
 		t.Error("Trusted = false, want true")
 	}
+	if d.Blocked {
+		t.Error("Blocked = true, want false")
+	}
+}
+
+func TestParseDeviceInfoBlocked(t *testing.T) {
+	input := `Device 11:22:33:44:55:66 (random)
+	Name: Neighbour Speaker
+	Paired: no
+	Trusted: no
+	Blocked: yes
+	Connected: no
+`
+	d := parseDeviceInfo([]byte(input), testMACMouse)
+	if !d.Blocked {
+		t.Error("Blocked = false, want true")
+	}
+	if d.Connected || d.Paired || d.Trusted {
+		t.Errorf("unexpected state: %+v", d)
+	}
+}
+
+func TestParseDeviceInfoBattery(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    int
+		wantHas bool
+	}{
+		{"hex with decimal", "\tBattery Percentage: 0x4b (75)\n", 75, true},
+		{"plain decimal", "\tBattery Percentage: 100\n", 100, true},
+		{"bare hex", "\tBattery Percentage: 0x05\n", 5, true},
+		{"garbage", "\tBattery Percentage: unknown\n", 0, false},
+		{"absent", "\tName: Mouse\n", 0, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := parseDeviceInfo([]byte(tc.line), testMACMouse)
+			if d.HasBattery != tc.wantHas || d.Battery != tc.want {
+				t.Errorf("got (%d, %v), want (%d, %v)", d.Battery, d.HasBattery, tc.want, tc.wantHas)
+			}
+		})
+	}
+}
+
+func TestParseDeviceInfoSignal(t *testing.T) {
+	input := `Device AA:BB:CC:DD:EE:FF (random)
+	Name: Buds
+	RSSI: 0xffffffc4 (-60)
+	TxPower: 0x0004 (4)
+`
+	d := parseDeviceInfo([]byte(input), testMACHeadphones)
+	if !d.HasRSSI || d.RSSI != -60 {
+		t.Errorf("RSSI = (%d, %v), want (-60, true)", d.RSSI, d.HasRSSI)
+	}
+	if !d.HasTxPower || d.TxPower != 4 {
+		t.Errorf("TxPower = (%d, %v), want (4, true)", d.TxPower, d.HasTxPower)
+	}
+
+	d = parseDeviceInfo([]byte("\tName: Buds\n"), testMACHeadphones)
+	if d.HasRSSI || d.HasTxPower {
+		t.Errorf("expected no signal readings, got %+v", d)
+	}
+}
+
+func TestParseDeviceInfoDetails(t *testing.T) {
+	input := `Device 11:22:33:44:55:66 (random)
+	Name: MX Master 3
+	Alias: Office mouse
+	Paired: yes
+	Bonded: yes
+	LegacyPairing: no
+	Modalias: usb:v046DpB023d0011
+`
+	d := parseDeviceInfo([]byte(input), testMACMouse)
+	want := BluetoothDevice{
+		MAC:         testMACMouse,
+		Name:        "MX Master 3",
+		Alias:       "Office mouse",
+		AddressType: "random",
+		Paired:      true,
+		Bonded:      true,
+		Modalias:    "usb:v046DpB023d0011",
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("got %+v, want %+v", d, want)
+	}
 }
 
 func TestParseDeviceInfoDisconnected(t *testing.T) {
@@ -160,6 +249,54 @@ func TestParsePoweredStatus(t *testing.T) {
 	}
 }
 
+func TestParseMonitorLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  monitorLine
+		ok    bool
+	}{
+		{
+			name:  "property change",
+			input: "[CHG] Device AA:BB:CC:DD:EE:FF Connected: no",
+			want:  monitorLine{tag: "CHG", object: "Device", mac: testMACHeadphones, key: "Connected", value: "no"},
+			ok:    true,
+		},
+		{
+			name:  "colored with prompt",
+			input: "\r\x1b[K[bluetooth]# \x1b[0;93m[CHG]\x1b[0m Controller 11:22:33:44:55:66 Powered: yes",
+			want:  monitorLine{tag: "CHG", object: "Controller", mac: testMACMouse, key: "Powered", value: "yes"},
+			ok:    true,
+		},
+		{
+			name:  "new device",
+			input: "[NEW] Device 11:22:33:44:55:66 Mouse",
+			want:  monitorLine{tag: "NEW", object: "Device", mac: testMACMouse},
+			ok:    true,
+		},
+		{
+			name:  "deleted device",
+			input: "[DEL] Device AA:BB:CC:DD:EE:FF Headphones",
+			want:  monitorLine{tag: "DEL", object: "Device", mac: testMACHeadphones},
+			ok:    true,
+		},
+		{"agent output", "Agent registered", monitorLine{}, false},
+		{"bad MAC", "[CHG] Device NOT-A-MAC Connected: yes", monitorLine{}, false},
+		{"transport", "[NEW] Transport /org/bluez/hci0/dev_AA_BB/fd0", monitorLine{}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseMonitorLine(tc.input)
+			if ok != tc.ok {
+				t.Fatalf("ok = %v, want %v", ok, tc.ok)
+			}
+			if ok && got != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestValidateMAC(t *testing.T) {
 	valid := []string{
 		testMACHeadphones,
@@ -209,7 +346,7 @@ func TestGetDevicesWithMock(t *testing.T) {
 		return nil, errors.New("unexpected call: " + strings.Join(args, " "))
 	}
 
-	devs, err := getDevices(context.Background())
+	devs, err := getDevices(context.Background(), infoFetchConcurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -264,3 +401,194 @@ func TestIsBluetoothEnabledMock(t *testing.T) {
 		t.Error("expected enabled=true")
 	}
 }
+
+func TestBluetoothctlAdapters(t *testing.T) {
+	original := runBluetoothctl
+	t.Cleanup(func() { runBluetoothctl = original })
+	lists := 0
+	runBluetoothctl = func(_ context.Context, args ...string) ([]byte, error) {
+		switch strings.Join(args, " ") {
+		case "list":
+			lists++
+			return []byte("Controller 00:1A:7D:DA:71:13 laptop [default]\nController 5C:F3:70:8B:12:34 dongle\n"), nil
+		case "show 00:1A:7D:DA:71:13":
+			return []byte("\tPowered: yes\n"), nil
+		case "show 5C:F3:70:8B:12:34":
+			return []byte("\tPowered: no\n"), nil
+		case "show":
+			return []byte("\tPowered: yes\n"), nil
+		}
+		return nil, errors.New("unexpected call: " + strings.Join(args, " "))
+	}
+
+	adapters, err := bluetoothctlBackend{}.Adapters(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Adapter{
+		{MAC: "00:1A:7D:DA:71:13", Name: "laptop", Powered: true, Default: true},
+		{MAC: "5C:F3:70:8B:12:34", Name: "dongle"},
+	}
+	if !reflect.DeepEqual(adapters, want) {
+		t.Errorf("got %+v, want %+v", adapters, want)
+	}
+
+	// Only the default controller is reachable through bluetoothctl, and
+	// it is looked up once.
+	lists = 0
+	b := (bluetoothctlBackend{}).WithAdapter("00:1A:7D:DA:71:13")
+	for range 3 {
+		if _, err := b.Powered(context.Background()); err != nil {
+			t.Errorf("default adapter: %v", err)
+		}
+	}
+	if lists != 1 {
+		t.Errorf("listed adapters %d times, want 1", lists)
+	}
+	if _, err := (bluetoothctlBackend{}).WithAdapter("5C:F3:70:8B:12:34").Powered(context.Background()); !errors.Is(err, errAdapterUnreachable) {
+		t.Errorf("second adapter: got %v, want %v", err, errAdapterUnreachable)
+	}
+
+	// --adapter refuses the second controller up front.
+	if _, _, err := selectAdapter(context.Background(), bluetoothctlBackend{}, "dongle"); !errors.Is(err, errAdapterUnreachable) {
+		t.Errorf("selectAdapter(dongle): got %v, want %v", err, errAdapterUnreachable)
+	}
+	if _, mac, err := selectAdapter(context.Background(), bluetoothctlBackend{}, "laptop"); err != nil || mac != "00:1A:7D:DA:71:13" {
+		t.Errorf("selectAdapter(laptop) = %q, %v", mac, err)
+	}
+}
+
+func TestBluetoothctlAdapterSettings(t *testing.T) {
+	show := `Controller 00:1A:7D:DA:71:13 (public)
+	Name: BlueZ 5.72
+	Alias: laptop
+	Powered: yes
+	Discoverable: yes
+	DiscoverableTimeout: 0x000000b4 (180)
+	Pairable: no
+`
+	want := Adapter{MAC: "00:1A:7D:DA:71:13", Name: "laptop", Powered: true, Discoverable: true, DiscoverableTimeout: 3 * time.Minute}
+	if got := parseAdapterInfo([]byte(show)); got != want {
+		t.Errorf("parseAdapterInfo = %+v, want %+v", got, want)
+	}
+
+	original := runBluetoothctlCombined
+	t.Cleanup(func() { runBluetoothctlCombined = original })
+	var calls []string
+	runBluetoothctlCombined = func(_ context.Context, args ...string) ([]byte, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return nil, nil
+	}
+	on, off, alias, timeout := true, false, "desk", 5*time.Minute
+	err := bluetoothctlBackend{}.ConfigureAdapter(context.Background(), AdapterSettings{
+		Alias: &alias, Discoverable: &on, DiscoverableTimeout: &timeout, Pairable: &off,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCalls := []string{"system-alias desk", "pairable off", "discoverable-timeout 300", "discoverable on"}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("calls = %v, want %v", calls, wantCalls)
+	}
+
+	err = bluetoothctlBackend{}.ConfigureAdapter(context.Background(), AdapterSettings{PairableTimeout: &timeout})
+	if !errors.Is(err, errPairableTimeout) {
+		t.Errorf("pairable timeout: got %v, want %v", err, errPairableTimeout)
+	}
+}
+
+func TestDeviceTrackerAdvertisements(t *testing.T) {
+	known := BluetoothDevice{MAC: testMACMouse, Name: "MX Master 3", RSSI: -60, HasRSSI: true, TxPower: 4, HasTxPower: true}
+	tests := []struct {
+		name      string
+		line      string
+		wantEvent bool
+		want      BluetoothDevice
+	}{
+		{"rssi", " RSSI: 0xffffffb5 (-75)", true, BluetoothDevice{MAC: testMACMouse, Name: "MX Master 3", RSSI: -75, HasRSSI: true, TxPower: 4, HasTxPower: true}},
+		{"rssi cleared", " RSSI is nil", true, BluetoothDevice{MAC: testMACMouse, Name: "MX Master 3", TxPower: 4, HasTxPower: true}},
+		{"tx power cleared", " TxPower is nil", true, BluetoothDevice{MAC: testMACMouse, Name: "MX Master 3", RSSI: -60, HasRSSI: true}},
+		{"manufacturer data", " ManufacturerData Key: 0x004c", false, known},
+		{"manufacturer data cleared", " ManufacturerData is nil", false, known},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tracker := newDeviceTracker(time.Second)
+			tracker.devices[testMACMouse] = known
+			ml, ok := parseMonitorLine("[CHG] Device " + testMACMouse + tc.line)
+			if !ok {
+				t.Fatalf("parseMonitorLine(%q) failed", tc.line)
+			}
+			ev, ok := tracker.event(context.Background(), ml)
+			if ok != tc.wantEvent {
+				t.Fatalf("event = %+v, %v; want an event: %v", ev, ok, tc.wantEvent)
+			}
+			if ok && (ev.Kind != EventDeviceChanged || !reflect.DeepEqual(ev.Device, tc.want)) {
+				t.Errorf("event = %+v, want a change to %+v", ev, tc.want)
+			}
+			if got := tracker.devices[testMACMouse]; !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("tracked %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBluetoothctlDiscover(t *testing.T) {
+	originalMonitor, originalRun := runBluetoothctlMonitor, runBluetoothctl
+	t.Cleanup(func() { runBluetoothctlMonitor, runBluetoothctl = originalMonitor, originalRun })
+	var commands []string
+	runBluetoothctlMonitor = func(ctx context.Context, onLine func(string), cmds ...string) error {
+		commands = cmds
+		onLine("[bluetooth]# Discovery started")
+		onLine("[NEW] Device " + testMACMouse + " MX Master 3")
+		onLine("[CHG] Controller 00:1A:7D:DA:71:13 Discovering: yes")
+		// Advertisements update the known device without another lookup.
+		onLine("[CHG] Device " + testMACMouse + " RSSI: 0xffffffc4 (-60)")
+		onLine("[CHG] Device " + testMACMouse + " ManufacturerData Key: 0x004c")
+		onLine("[DEL] Device " + testMACHeadphones + " WH-1000XM4")
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	lookups := 0
+	var lookupBudget time.Duration
+	runBluetoothctl = func(ctx context.Context, args ...string) ([]byte, error) {
+		if strings.Join(args, " ") == "info "+testMACMouse {
+			lookups++
+			if deadline, ok := ctx.Deadline(); ok {
+				lookupBudget = time.Until(deadline)
+			}
+			return []byte("Device " + testMACMouse + " (public)\n\tName: MX Master 3\n\tRSSI: -58\n"), nil
+		}
+		return nil, errors.New("unexpected call: " + strings.Join(args, " "))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	filter, err := parseDiscoveryFilter([]string{"transport=le", "rssi=-80", "uuids=hid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := bluetoothctlBackend{commandTimeout: time.Minute}.Discover(ctx, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := <-found; d.MAC != testMACMouse || !d.HasRSSI || d.RSSI != -58 {
+		t.Errorf("found %+v, want the mouse at -58 dBm", d)
+	}
+	if d := <-found; d.MAC != testMACMouse || d.Name != "MX Master 3" || d.RSSI != -60 {
+		t.Errorf("found %+v, want the mouse at -60 dBm", d)
+	}
+	cancel()
+	if _, ok := <-found; ok {
+		t.Error("expected only the mouse's updates, then a closed channel")
+	}
+	if lookupBudget <= cmdTimeout {
+		t.Errorf("info lookup had %v, want the configured minute", lookupBudget)
+	}
+	if lookups != 1 {
+		t.Errorf("looked the mouse up %d times, want once", lookups)
+	}
+	want := []string{"menu scan", "clear", "transport le", "rssi -80", "uuids 00001124" + bluetoothBaseUUID, "back", "scan on"}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("commands = %v, want %v", commands, want)
+	}
+}
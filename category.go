@@ -0,0 +1,226 @@
+package main
+
+import "strings"
+
+// DeviceCategory is what kind of device something is, named after the
+// freedesktop icon names BlueZ reports in the Icon property.
+type DeviceCategory string
+
+const (
+	CategoryUnknown    DeviceCategory = "unknown"
+	CategoryHeadset    DeviceCategory = "audio-headset"
+	CategoryHeadphones DeviceCategory = "audio-headphones"
+	CategorySpeaker    DeviceCategory = "audio-speaker"
+	CategoryMouse      DeviceCategory = "input-mouse"
+	CategoryKeyboard   DeviceCategory = "input-keyboard"
+	CategoryGamepad    DeviceCategory = "input-gaming"
+	CategoryTablet     DeviceCategory = "input-tablet"
+	CategoryPhone      DeviceCategory = "phone"
+	CategoryComputer   DeviceCategory = "computer"
+	CategoryWatch      DeviceCategory = "watch"
+	CategoryDisplay    DeviceCategory = "video-display"
+	CategoryCamera     DeviceCategory = "camera"
+	CategoryPrinter    DeviceCategory = "printer"
+	CategoryNetwork    DeviceCategory = "network"
+)
+
+// categoryIcons maps each category to a glyph and a fixed-width ASCII
+// stand-in for terminals without emoji.
+var categoryIcons = map[DeviceCategory][2]string{
+	CategoryUnknown:    {"  ", "   "},
+	CategoryHeadset:    {"🎧", "hs "},
+	CategoryHeadphones: {"🎧", "hp "},
+	CategorySpeaker:    {"🔊", "spk"},
+	CategoryMouse:      {"🖱️", "ms "},
+	CategoryKeyboard:   {"⌨️", "kb "},
+	CategoryGamepad:    {"🎮", "gp "},
+	CategoryTablet:     {"✏️", "tab"},
+	CategoryPhone:      {"📱", "ph "},
+	CategoryComputer:   {"💻", "pc "},
+	CategoryWatch:      {"⌚", "wt "},
+	CategoryDisplay:    {"📺", "tv "},
+	CategoryCamera:     {"📷", "cam"},
+	CategoryPrinter:    {"🖨️", "prn"},
+	CategoryNetwork:    {"🌐", "net"},
+}
+
+// Category works out the device type from the Icon BlueZ reports, falling
+// back to the Class of Device (classic) and then the GAP Appearance (LE).
+func (d BluetoothDevice) Category() DeviceCategory {
+	if c := categoryFromIcon(d.Icon); c != CategoryUnknown {
+		return c
+	}
+	if c := categoryFromClass(d.Class); c != CategoryUnknown {
+		return c
+	}
+	return categoryFromAppearance(d.Appearance)
+}
+
+func categoryFromIcon(icon string) DeviceCategory {
+	switch icon {
+	case "audio-headset":
+		return CategoryHeadset
+	case "audio-headphones":
+		return CategoryHeadphones
+	case "audio-card":
+		return CategorySpeaker
+	case "input-mouse":
+		return CategoryMouse
+	case "input-keyboard":
+		return CategoryKeyboard
+	case "input-gaming":
+		return CategoryGamepad
+	case "input-tablet":
+		return CategoryTablet
+	case "phone":
+		return CategoryPhone
+	case "computer":
+		return CategoryComputer
+	case "video-display":
+		return CategoryDisplay
+	case "printer", "scanner":
+		return CategoryPrinter
+	case "network-wireless", "modem":
+		return CategoryNetwork
+	}
+	if strings.HasPrefix(icon, "camera") {
+		return CategoryCamera
+	}
+	return CategoryUnknown
+}
+
+// Class of Device tables, keyed by the bits each is read from. Majors
+// listed in classMajors need no minor class.
+var (
+	classMajors = map[uint32]DeviceCategory{
+		0x01: CategoryComputer,
+		0x02: CategoryPhone,
+		0x03: CategoryNetwork,
+		0x07: CategoryWatch,
+	}
+	// classAudioVideo is keyed by the audio/video minor class.
+	classAudioVideo = map[uint32]DeviceCategory{
+		0x01: CategoryHeadset,
+		0x02: CategoryHeadset,
+		0x05: CategorySpeaker,
+		0x06: CategoryHeadphones,
+		0x07: CategorySpeaker,
+		0x0a: CategorySpeaker,
+		0x0c: CategoryCamera,
+		0x0d: CategoryCamera,
+		0x0f: CategoryDisplay,
+		0x10: CategoryDisplay,
+	}
+	// classPeripheralTypes is keyed by the low four bits of a peripheral's
+	// minor class, and classPeripheralKinds by the two above them; the
+	// type is checked first.
+	classPeripheralTypes = map[uint32]DeviceCategory{
+		0x01: CategoryGamepad,
+		0x02: CategoryGamepad,
+		0x05: CategoryTablet,
+	}
+	classPeripheralKinds = map[uint32]DeviceCategory{
+		0x01: CategoryKeyboard,
+		0x02: CategoryMouse,
+		0x03: CategoryKeyboard,
+	}
+	// classImaging lists the imaging class bits in the order they're
+	// checked, as a device may set several.
+	classImaging = []struct {
+		bit      uint32
+		category DeviceCategory
+	}{
+		{0x80, CategoryPrinter},
+		{0x20, CategoryCamera},
+		{0x10, CategoryDisplay},
+	}
+)
+
+// categoryFromClass decodes the major and minor device class fields of a
+// 24-bit Class of Device.
+func categoryFromClass(class uint32) DeviceCategory {
+	major, minor := (class>>8)&0x1f, (class>>2)&0x3f
+	if c, ok := classMajors[major]; ok {
+		return c
+	}
+	switch major {
+	case 0x04:
+		return categoryIn(classAudioVideo, minor)
+	case 0x05:
+		if c, ok := classPeripheralTypes[minor&0x0f]; ok {
+			return c
+		}
+		return categoryIn(classPeripheralKinds, minor>>4)
+	case 0x06:
+		for _, b := range classImaging {
+			if class&b.bit != 0 {
+				return b.category
+			}
+		}
+	}
+	return CategoryUnknown
+}
+
+func categoryIn(table map[uint32]DeviceCategory, key uint32) DeviceCategory {
+	if c, ok := table[key]; ok {
+		return c
+	}
+	return CategoryUnknown
+}
+
+// categoryFromAppearance decodes the 10-bit category and 6-bit subcategory
+// of a GAP Appearance value.
+func categoryFromAppearance(appearance uint16) DeviceCategory {
+	sub := appearance & 0x3f
+	switch appearance >> 6 {
+	case 0x001:
+		return CategoryPhone
+	case 0x002:
+		return CategoryComputer
+	case 0x003:
+		return CategoryWatch
+	case 0x005:
+		return CategoryDisplay
+	case 0x00f:
+		switch sub {
+		case 0x01:
+			return CategoryKeyboard
+		case 0x02:
+			return CategoryMouse
+		case 0x03, 0x04:
+			return CategoryGamepad
+		case 0x05:
+			return CategoryTablet
+		}
+	case 0x021:
+		return CategorySpeaker
+	case 0x025:
+		if sub == 0x03 {
+			return CategoryHeadphones
+		}
+		return CategoryHeadset
+	}
+	return CategoryUnknown
+}
+
+// categoryIcon returns the glyph for c, or its ASCII stand-in.
+func categoryIcon(c DeviceCategory, ascii bool) string {
+	icons, ok := categoryIcons[c]
+	if !ok {
+		icons = categoryIcons[CategoryUnknown]
+	}
+	if ascii {
+		return icons[1]
+	}
+	return icons[0]
+}
+
+// unicodeTerminal guesses whether the terminal can draw emoji: the Linux
+// console can't, and neither can a non-UTF-8 locale.
+func unicodeTerminal(term, locale string) bool {
+	if term == "linux" || term == "dumb" {
+		return false
+	}
+	locale = strings.ToUpper(locale)
+	return locale == "" || strings.Contains(locale, "UTF-8") || strings.Contains(locale, "UTF8")
+}
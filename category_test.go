@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestDeviceCategory(t *testing.T) {
+	tests := []struct {
+		name   string
+		device BluetoothDevice
+		want   DeviceCategory
+	}{
+		{"icon wins", BluetoothDevice{Icon: "input-mouse", Class: 0x240404}, CategoryMouse},
+		{"headset class", BluetoothDevice{Class: 0x240404}, CategoryHeadset},
+		{"headphones class", BluetoothDevice{Class: 0x240418}, CategoryHeadphones},
+		{"keyboard class", BluetoothDevice{Class: 0x000540}, CategoryKeyboard},
+		{"mouse class", BluetoothDevice{Class: 0x002580}, CategoryMouse},
+		{"gamepad class", BluetoothDevice{Class: 0x000508}, CategoryGamepad},
+		{"phone class", BluetoothDevice{Class: 0x5a020c}, CategoryPhone},
+		{"laptop class", BluetoothDevice{Class: 0x10010c}, CategoryComputer},
+		{"LE keyboard", BluetoothDevice{Appearance: 0x03c1}, CategoryKeyboard},
+		{"LE mouse", BluetoothDevice{Appearance: 0x03c2}, CategoryMouse},
+		{"LE earbud", BluetoothDevice{Appearance: 0x0941}, CategoryHeadset},
+		{"LE headphones", BluetoothDevice{Appearance: 0x0943}, CategoryHeadphones},
+		{"unknown icon falls back", BluetoothDevice{Icon: "something-new", Appearance: 0x0040}, CategoryPhone},
+		{"nothing known", BluetoothDevice{}, CategoryUnknown},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.device.Category(); got != tc.want {
+				t.Errorf("Category() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseDeviceInfoCategory(t *testing.T) {
+	input := `Device AA:BB:CC:DD:EE:FF (public)
+	Name: WH-1000XM4
+	Class: 0x00240404 (2360324)
+	Icon: audio-headset
+	Appearance: 0x03c2 (962)
+`
+	d := parseDeviceInfo([]byte(input), testMACHeadphones)
+	if d.Icon != "audio-headset" || d.Class != 0x240404 || d.Appearance != 0x03c2 {
+		t.Errorf("got icon %q class %#x appearance %#x", d.Icon, d.Class, d.Appearance)
+	}
+}
+
+func TestUnicodeTerminal(t *testing.T) {
+	tests := []struct {
+		term, locale string
+		want         bool
+	}{
+		{"xterm-kitty", "en_US.UTF-8", true},
+		{"foot", "de_DE.utf8", true},
+		{"xterm-256color", "", true},
+		{"linux", "en_US.UTF-8", false},
+		{"xterm", "C", false},
+	}
+	for _, tc := range tests {
+		if got := unicodeTerminal(tc.term, tc.locale); got != tc.want {
+			t.Errorf("unicodeTerminal(%q, %q) = %v, want %v", tc.term, tc.locale, got, tc.want)
+		}
+	}
+}
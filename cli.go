@@ -0,0 +1,541 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Exit codes for the non-interactive subcommands.
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsage    = 2
+	exitNotFound = 3
+)
+
+var (
+	errDeviceNotFound  = errors.New("device not found")
+	errDeviceAmbiguous = errors.New("device name is ambiguous")
+	errUsage           = errors.New("usage error")
+)
+
+type cliCommand struct {
+	name  string
+	args  string
+	usage string
+	run   func(ctx context.Context, c *cli, args []string) error
+}
+
+// cliCommands is ordered as it appears in the help output.
+var cliCommands = []cliCommand{
+	{"list", "[--json|--format F]", "list known devices", runList},
+	{"status", "[--json|--format F]", "show adapter power and connected devices", runStatus},
+	{"connect", "[--profile P] <MAC|name>", "connect to a device, or one of its profiles", runConnect},
+	{"disconnect", "[--profile P] [MAC|name]", "disconnect a device, or every connected device", runDisconnect},
+	{"profiles", "[--json|--format F] <MAC|name>", "list the services a device advertises", runProfiles},
+	{"pair", "<MAC|name>", "pair and trust a device", runPair},
+	{"trust", "<MAC|name>", "trust a device", runTrust},
+	{"untrust", "<MAC|name>", "stop trusting a device", runUntrust},
+	{"block", "<MAC|name>", "block a device from connecting", runBlock},
+	{"unblock", "<MAC|name>", "allow a blocked device again", runUnblock},
+	{"remove", "<MAC|name>", "unpair and forget a device", runRemove},
+	{"rename", "<MAC|name> [new name]", "rename a device; leave out the name to restore its own", runRename},
+	{"power", "on|off|toggle", "switch the adapter on or off", runPower},
+	{"adapters", "[--json|--format F]", "list Bluetooth controllers", runAdapters},
+	{"adapter", "[show|set key=value...]", "show or change the adapter's settings", runAdapter},
+	{"scan", "[--duration 5s] [--json] [key=value...]", "discover nearby devices, optionally filtered", runScan},
+	{"waybar", "[watch|toggle|next|prev]", "Waybar custom module output and actions", runWaybar},
+}
+
+type cli struct {
+	backend  Backend
+	timeouts Timeouts
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+func findCLICommand(name string) (cliCommand, bool) {
+	for _, cmd := range cliCommands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return cliCommand{}, false
+}
+
+// runCLI runs one subcommand and returns the process exit code.
+func runCLI(b Backend, t Timeouts, args []string, stdout, stderr io.Writer) int {
+	cmd, ok := findCLICommand(args[0])
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q; run 'hyprBluetooth --help' for usage\n", args[0])
+		return exitUsage
+	}
+	c := &cli{backend: b, timeouts: t, stdout: stdout, stderr: stderr}
+	if err := cmd.run(context.Background(), c, args[1:]); err != nil {
+		fmt.Fprintf(stderr, "hyprBluetooth %s: %v\n", cmd.name, err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, errDeviceNotFound), errors.Is(err, errDeviceAmbiguous):
+		return exitNotFound
+	default:
+		return exitFailure
+	}
+}
+
+func usageError(format string, a ...any) error {
+	return fmt.Errorf("%w: %s", errUsage, fmt.Sprintf(format, a...))
+}
+
+// resolveDevice accepts a MAC address or a (case-insensitive) name or
+// alias. An exact match wins; otherwise the query must match a fragment of
+// a single device's names.
+func resolveDevice(ctx context.Context, b Backend, query string) (BluetoothDevice, error) {
+	if validateMAC(query) == nil {
+		return BluetoothDevice{MAC: strings.ToUpper(query)}, nil
+	}
+	devices, err := b.ListDevices(ctx)
+	if err != nil {
+		return BluetoothDevice{}, err
+	}
+	return matchDevice(devices, query)
+}
+
+func matchDevice(devices []BluetoothDevice, query string) (BluetoothDevice, error) {
+	q := strings.ToLower(query)
+	var partial []BluetoothDevice
+	for _, d := range devices {
+		names := []string{strings.ToLower(d.Name)}
+		if d.HasAlias() {
+			names = append(names, strings.ToLower(d.Alias))
+		}
+		if slices.Contains(names, q) {
+			return d, nil
+		}
+		if slices.ContainsFunc(names, func(name string) bool { return strings.Contains(name, q) }) {
+			partial = append(partial, d)
+		}
+	}
+	switch len(partial) {
+	case 0:
+		return BluetoothDevice{}, fmt.Errorf("%w: %q", errDeviceNotFound, query)
+	case 1:
+		return partial[0], nil
+	}
+	names := make([]string, 0, len(partial))
+	for _, d := range partial {
+		names = append(names, fmt.Sprintf("%s (%s)", d.DisplayName(), d.MAC))
+	}
+	return BluetoothDevice{}, fmt.Errorf("%w: %q matches %s", errDeviceAmbiguous, query, strings.Join(names, ", "))
+}
+
+// selectAdapter points b at the controller named by query, a MAC address
+// or adapter name, and returns its address. An empty query keeps the
+// default controller; one the backend can't reach is refused here rather
+// than by every operation.
+func selectAdapter(ctx context.Context, b Backend, query string) (Backend, string, error) {
+	if query == "" {
+		return b, "", nil
+	}
+	adapters, err := b.Adapters(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, a := range adapters {
+		if !strings.EqualFold(a.MAC, query) && !strings.EqualFold(a.Name, query) {
+			continue
+		}
+		if !adapterReachable(b, a) {
+			return nil, "", fmt.Errorf("%w (%s)", errAdapterUnreachable, a.MAC)
+		}
+		return b.WithAdapter(a.MAC), a.MAC, nil
+	}
+	return nil, "", fmt.Errorf("%w: adapter %q", errDeviceNotFound, query)
+}
+
+func deviceArg(ctx context.Context, c *cli, args []string) (BluetoothDevice, error) {
+	if len(args) != 1 {
+		return BluetoothDevice{}, usageError("expected exactly one MAC address or device name")
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, c.timeouts.Command)
+	defer cancel()
+	return resolveDevice(lookupCtx, c.backend, args[0])
+}
+
+func deviceState(d BluetoothDevice) string {
+	switch {
+	case d.Blocked:
+		return "blocked"
+	case d.Connected:
+		return "connected"
+	case d.Paired:
+		return "paired"
+	default:
+		return "available"
+	}
+}
+
+// formatFlags registers --json and --format on fs; call the returned
+// function after parsing to get the selected output format.
+func formatFlags(fs *flag.FlagSet) func() (string, error) {
+	asJSON := fs.Bool("json", false, "shorthand for --format=json")
+	format := fs.String("format", "", "output format: plain, json or tsv")
+	return func() (string, error) {
+		return parseFormat(*format, *asJSON)
+	}
+}
+
+func newFlagSet(c *cli, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	return fs
+}
+
+func runList(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet(c, "list")
+	outputFormat := formatFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError("%v", err)
+	}
+	if fs.NArg() != 0 {
+		return usageError("list takes no arguments")
+	}
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.Command)
+	defer cancel()
+	devices, err := c.backend.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	return writeDeviceList(c.stdout, format, devices)
+}
+
+func runStatus(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet(c, "status")
+	outputFormat := formatFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError("%v", err)
+	}
+	if fs.NArg() != 0 {
+		return usageError("status takes no arguments")
+	}
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.Command)
+	defer cancel()
+	powered, err := c.backend.Powered(ctx)
+	if err != nil {
+		return err
+	}
+	devices, err := c.backend.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	return writeStatus(c.stdout, format, powered, devices)
+}
+
+// profileFlag registers --profile on fs; call the returned function after
+// parsing to get the selected UUID, or "" for the whole device.
+func profileFlag(fs *flag.FlagSet) func() (string, error) {
+	profile := fs.String("profile", "", "a single profile: UUID, 16-bit UUID or name such as A2DP or HFP")
+	return func() (string, error) {
+		if *profile == "" {
+			return "", nil
+		}
+		uuid, err := resolveProfile(*profile)
+		if err != nil {
+			return "", usageError("%v", err)
+		}
+		return uuid, nil
+	}
+}
+
+func runConnect(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet(c, "connect")
+	selectedProfile := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError("%v", err)
+	}
+	uuid, err := selectedProfile()
+	if err != nil {
+		return err
+	}
+	if uuid == "" {
+		return runDeviceOp(ctx, c, fs.Args(), c.backend.Connect)
+	}
+	return runDeviceOp(ctx, c, fs.Args(), func(ctx context.Context, mac string) error {
+		return c.backend.ConnectProfile(ctx, mac, uuid)
+	})
+}
+
+func runDisconnect(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet(c, "disconnect")
+	selectedProfile := profileFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError("%v", err)
+	}
+	uuid, err := selectedProfile()
+	if err != nil {
+		return err
+	}
+	args = fs.Args()
+	if uuid != "" {
+		return runDeviceOp(ctx, c, args, func(ctx context.Context, mac string) error {
+			return c.backend.DisconnectProfile(ctx, mac, uuid)
+		})
+	}
+	if len(args) > 0 {
+		d, err := deviceArg(ctx, c, args)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(ctx, c.timeouts.Command)
+		defer cancel()
+		return c.backend.Disconnect(ctx, d.MAC)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.Command)
+	defer cancel()
+	devices, err := c.backend.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, d := range devices {
+		if d.Connected {
+			errs = append(errs, c.backend.Disconnect(ctx, d.MAC))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func runProfiles(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet(c, "profiles")
+	outputFormat := formatFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError("%v", err)
+	}
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+	d, err := deviceArg(ctx, c, fs.Args())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.Command)
+	defer cancel()
+	// resolveDevice only fills in the MAC when given one.
+	if d, err = c.backend.DeviceInfo(ctx, d.MAC); err != nil {
+		return err
+	}
+	return writeProfiles(c.stdout, format, deviceProfiles(d))
+}
+
+func runPair(ctx context.Context, c *cli, args []string) error {
+	d, err := deviceArg(ctx, c, args)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.Pair)
+	defer cancel()
+	if err := c.backend.Pair(ctx, d.MAC); err != nil {
+		return err
+	}
+	if err := c.backend.Trust(ctx, d.MAC); err != nil {
+		return fmt.Errorf("paired but failed to trust: %w", err)
+	}
+	return nil
+}
+
+// runDeviceOp resolves the single device argument and applies op to it.
+func runDeviceOp(ctx context.Context, c *cli, args []string, op func(context.Context, string) error) error {
+	d, err := deviceArg(ctx, c, args)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.Command)
+	defer cancel()
+	return op(ctx, d.MAC)
+}
+
+func runTrust(ctx context.Context, c *cli, args []string) error {
+	return runDeviceOp(ctx, c, args, c.backend.Trust)
+}
+
+func runUntrust(ctx context.Context, c *cli, args []string) error {
+	return runDeviceOp(ctx, c, args, c.backend.Untrust)
+}
+
+func runBlock(ctx context.Context, c *cli, args []string) error {
+	return runDeviceOp(ctx, c, args, c.backend.Block)
+}
+
+func runUnblock(ctx context.Context, c *cli, args []string) error {
+	return runDeviceOp(ctx, c, args, c.backend.Unblock)
+}
+
+func runRemove(ctx context.Context, c *cli, args []string) error {
+	return runDeviceOp(ctx, c, args, c.backend.Remove)
+}
+
+// runRename sets the alias in BlueZ for a paired device and in the local
+// alias store otherwise; see aliasBackend.
+func runRename(ctx context.Context, c *cli, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("expected a MAC address or device name and a new name; quote a name with spaces")
+	}
+	var alias string
+	if len(args) == 2 {
+		alias = strings.TrimSpace(args[1])
+	}
+	if len(alias) > maxAliasLength {
+		return usageError("name is longer than %d bytes", maxAliasLength)
+	}
+	d, err := deviceArg(ctx, c, args[:1])
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.Command)
+	defer cancel()
+	return c.backend.SetAlias(ctx, d.MAC, alias)
+}
+
+func runPower(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 1 {
+		return usageError("expected on, off or toggle")
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.Command)
+	defer cancel()
+
+	var on bool
+	switch args[0] {
+	case "on":
+		on = true
+	case "off":
+		on = false
+	case "toggle":
+		powered, err := c.backend.Powered(ctx)
+		if err != nil {
+			return err
+		}
+		on = !powered
+	default:
+		return usageError("expected on, off or toggle, got %q", args[0])
+	}
+	return c.backend.Power(ctx, on)
+}
+
+func runAdapters(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet(c, "adapters")
+	outputFormat := formatFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError("%v", err)
+	}
+	if fs.NArg() != 0 {
+		return usageError("adapters takes no arguments")
+	}
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.Command)
+	defer cancel()
+	adapters, err := c.backend.Adapters(ctx)
+	if err != nil {
+		return err
+	}
+	return writeAdapters(c.stdout, format, adapters)
+}
+
+// runAdapter shows the selected adapter, or with "set" changes its alias,
+// discoverable and pairable settings, e.g.
+// `adapter set discoverable=on discoverable-timeout=3m`.
+func runAdapter(ctx context.Context, c *cli, args []string) error {
+	if len(args) > 0 && args[0] == "set" {
+		if len(args) == 1 {
+			return usageError("expected key=value settings: %s", strings.Join(adapterSettingKeys, ", "))
+		}
+		settings, err := parseAdapterSettings(args[1:])
+		if err != nil {
+			return usageError("%v", err)
+		}
+		ctx, cancel := context.WithTimeout(ctx, c.timeouts.Command)
+		defer cancel()
+		return c.backend.ConfigureAdapter(ctx, settings)
+	}
+	if len(args) > 0 && args[0] == "show" {
+		args = args[1:]
+	}
+	fs := newFlagSet(c, "adapter")
+	outputFormat := formatFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError("%v", err)
+	}
+	if fs.NArg() != 0 {
+		return usageError("expected show or set, got %q", fs.Arg(0))
+	}
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.Command)
+	defer cancel()
+	adapter, err := c.backend.AdapterInfo(ctx)
+	if err != nil {
+		return err
+	}
+	return writeAdapter(c.stdout, format, adapter)
+}
+
+func runScan(ctx context.Context, c *cli, args []string) error {
+	fs := newFlagSet(c, "scan")
+	duration := fs.Duration("duration", c.timeouts.Scan, "how long to scan for")
+	outputFormat := formatFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError("%v", err)
+	}
+	if *duration <= 0 {
+		return usageError("--duration must be positive")
+	}
+	filter, err := parseDiscoveryFilter(fs.Args())
+	if err != nil {
+		return usageError("%v", err)
+	}
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, *duration+c.timeouts.Command)
+	defer cancel()
+	devices, err := scanFor(ctx, c.backend, *duration, filter)
+	if err != nil {
+		return err
+	}
+	return writeDeviceList(c.stdout, format, devices)
+}
+
+func printCommandUsage(w io.Writer) {
+	for _, cmd := range cliCommands {
+		usage := strings.TrimSpace(cmd.name + " " + cmd.args)
+		fmt.Fprintf(w, "  hyprBluetooth %-34s %s\n", usage, cmd.usage)
+	}
+}
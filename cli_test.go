@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBackend is a Backend over an in-memory device list that records the
+// operations it is asked to perform as "<op> <MAC>".
+type fakeBackend struct {
+	adapters []Adapter
+	adapter  string
+	devices  []BluetoothDevice
+	powered  bool
+	calls    []string
+	err      error
+	events   chan Event
+}
+
+func (f *fakeBackend) record(op, mac string) error {
+	f.calls = append(f.calls, strings.TrimSpace(op+" "+mac))
+	return f.err
+}
+
+func (f *fakeBackend) ListDevices(context.Context) ([]BluetoothDevice, error) {
+	return f.devices, f.err
+}
+
+func (f *fakeBackend) DeviceInfo(_ context.Context, mac string) (BluetoothDevice, error) {
+	for _, d := range f.devices {
+		if d.MAC == mac {
+			return d, nil
+		}
+	}
+	return BluetoothDevice{}, errors.New("no such device")
+}
+
+func (f *fakeBackend) Connect(_ context.Context, mac string) error {
+	return f.record("connect", mac)
+}
+
+func (f *fakeBackend) Disconnect(_ context.Context, mac string) error {
+	return f.record("disconnect", mac)
+}
+
+func (f *fakeBackend) ConnectProfile(_ context.Context, mac, uuid string) error {
+	return f.record("connect-profile", mac+" "+uuid)
+}
+
+func (f *fakeBackend) DisconnectProfile(_ context.Context, mac, uuid string) error {
+	return f.record("disconnect-profile", mac+" "+uuid)
+}
+
+func (f *fakeBackend) Pair(_ context.Context, mac string) error {
+	return f.record("pair", mac)
+}
+
+func (f *fakeBackend) Trust(_ context.Context, mac string) error {
+	return f.record("trust", mac)
+}
+
+func (f *fakeBackend) Untrust(_ context.Context, mac string) error {
+	return f.record("untrust", mac)
+}
+
+func (f *fakeBackend) Block(_ context.Context, mac string) error {
+	return f.record("block", mac)
+}
+
+func (f *fakeBackend) Unblock(_ context.Context, mac string) error {
+	return f.record("unblock", mac)
+}
+
+func (f *fakeBackend) Remove(_ context.Context, mac string) error {
+	return f.record("remove", mac)
+}
+
+func (f *fakeBackend) SetAlias(_ context.Context, mac, alias string) error {
+	return f.record("set-alias", mac+" "+alias)
+}
+
+func (f *fakeBackend) Powered(context.Context) (bool, error) {
+	return f.powered, f.err
+}
+
+func (f *fakeBackend) Power(_ context.Context, on bool) error {
+	f.powered = on
+	if on {
+		return f.record("power", "on")
+	}
+	return f.record("power", "off")
+}
+
+// Discover reports every device once, then waits for ctx like a real scan.
+func (f *fakeBackend) Discover(ctx context.Context, _ DiscoveryFilter) (<-chan BluetoothDevice, error) {
+	if err := f.record("discover", ""); err != nil {
+		return nil, err
+	}
+	found := make(chan BluetoothDevice, len(f.devices))
+	for _, d := range f.devices {
+		found <- d
+	}
+	go func() {
+		<-ctx.Done()
+		close(found)
+	}()
+	return found, nil
+}
+
+func (f *fakeBackend) Events(context.Context) (<-chan Event, error) {
+	if f.events == nil {
+		return nil, errors.New("events not supported")
+	}
+	return f.events, nil
+}
+
+func (f *fakeBackend) Adapters(context.Context) ([]Adapter, error) {
+	return f.adapters, f.err
+}
+
+// WithAdapter records the selection on the same fake, so tests can check
+// which controller the operations were routed to.
+func (f *fakeBackend) WithAdapter(mac string) Backend {
+	f.adapter = mac
+	return f
+}
+
+// selectedAdapter is the index of the adapter chosen with WithAdapter, or of
+// the default one.
+func (f *fakeBackend) selectedAdapter() int {
+	for i, a := range f.adapters {
+		if (f.adapter == "" && a.Default) || strings.EqualFold(a.MAC, f.adapter) {
+			return i
+		}
+	}
+	return 0
+}
+
+func (f *fakeBackend) AdapterInfo(context.Context) (Adapter, error) {
+	return f.adapters[f.selectedAdapter()], f.err
+}
+
+// ConfigureAdapter applies s to the selected adapter and records it as
+// "configure-adapter key=value...".
+func (f *fakeBackend) ConfigureAdapter(_ context.Context, s AdapterSettings) error {
+	a := &f.adapters[f.selectedAdapter()]
+	var changes []string
+	if s.Alias != nil {
+		a.Name = *s.Alias
+		changes = append(changes, "alias="+*s.Alias)
+	}
+	if s.Discoverable != nil {
+		a.Discoverable = *s.Discoverable
+		changes = append(changes, "discoverable="+onOff(*s.Discoverable))
+	}
+	if s.DiscoverableTimeout != nil {
+		a.DiscoverableTimeout = *s.DiscoverableTimeout
+		changes = append(changes, "discoverable-timeout="+formatTimeout(*s.DiscoverableTimeout))
+	}
+	if s.Pairable != nil {
+		a.Pairable = *s.Pairable
+		changes = append(changes, "pairable="+onOff(*s.Pairable))
+	}
+	if s.PairableTimeout != nil {
+		a.PairableTimeout = *s.PairableTimeout
+		changes = append(changes, "pairable-timeout="+formatTimeout(*s.PairableTimeout))
+	}
+	return f.record("configure-adapter", strings.Join(changes, " "))
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		adapters: []Adapter{
+			{MAC: "00:1A:7D:DA:71:13", Name: "laptop", Powered: true, Pairable: true, DiscoverableTimeout: 3 * time.Minute, Default: true},
+			{MAC: "5C:F3:70:8B:12:34", Name: "dongle"},
+		},
+		powered: true,
+		devices: []BluetoothDevice{
+			{MAC: testMACHeadphones, Name: "WH-1000XM4", Connected: true, Paired: true, Trusted: true, Icon: "audio-headset"},
+			{MAC: testMACMouse, Name: "MX Master 3", Paired: true, Icon: "input-mouse"},
+			{MAC: "22:33:44:55:66:77", Name: "MX Keys", Class: 0x000540},
+		},
+	}
+}
+
+func runCLIForTest(b Backend, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := runCLI(b, defaultTimeouts, args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCLIExitCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		want  int
+		calls []string
+	}{
+		{"connect by MAC", []string{"connect", testMACMouse}, exitOK, []string{"connect " + testMACMouse}},
+		{"connect by exact name", []string{"connect", "mx keys"}, exitOK, []string{"connect 22:33:44:55:66:77"}},
+		{"connect by fragment", []string{"connect", "master"}, exitOK, []string{"connect " + testMACMouse}},
+		{"ambiguous name", []string{"connect", "MX"}, exitNotFound, nil},
+		{"unknown name", []string{"connect", "speaker"}, exitNotFound, nil},
+		{"missing argument", []string{"connect"}, exitUsage, nil},
+		{"unknown command", []string{"frobnicate"}, exitUsage, nil},
+		{"pair trusts too", []string{"pair", "keys"}, exitOK, []string{"pair 22:33:44:55:66:77", "trust 22:33:44:55:66:77"}},
+		{"disconnect all", []string{"disconnect"}, exitOK, []string{"disconnect " + testMACHeadphones}},
+		{"remove by name", []string{"remove", "master"}, exitOK, []string{"remove " + testMACMouse}},
+		{"rename", []string{"rename", "master", " Work mouse "}, exitOK, []string{"set-alias " + testMACMouse + " Work mouse"}},
+		{"rename back", []string{"rename", testMACMouse}, exitOK, []string{"set-alias " + testMACMouse}},
+		{"rename unquoted", []string{"rename", "master", "Work", "mouse"}, exitUsage, nil},
+		{"rename too long", []string{"rename", "master", strings.Repeat("x", maxAliasLength+1)}, exitUsage, nil},
+		{"block by name", []string{"block", "keys"}, exitOK, []string{"block 22:33:44:55:66:77"}},
+		{"unblock by MAC", []string{"unblock", testMACMouse}, exitOK, []string{"unblock " + testMACMouse}},
+		{"untrust", []string{"untrust", "WH-1000XM4"}, exitOK, []string{"untrust " + testMACHeadphones}},
+		{"power toggle", []string{"power", "toggle"}, exitOK, []string{"power off"}},
+		{"power bad arg", []string{"power", "maybe"}, exitUsage, nil},
+		{"connect profile", []string{"connect", "--profile", "a2dp", "WH-1000XM4"}, exitOK, []string{"connect-profile " + testMACHeadphones + " " + testUUIDA2DP}},
+		{"disconnect profile", []string{"disconnect", "--profile", "hfp", testMACHeadphones}, exitOK, []string{"disconnect-profile " + testMACHeadphones + " " + testUUIDHFP}},
+		{"disconnect profile needs device", []string{"disconnect", "--profile", "hfp"}, exitUsage, nil},
+		{"unknown profile", []string{"connect", "--profile", "music", testMACHeadphones}, exitUsage, nil},
+		{"invalid profile UUID", []string{"connect", "--profile", "0000110b-0000-1000-8000-00805f9b34fz", testMACHeadphones}, exitUsage, nil},
+		{"scan duration", []string{"scan", "--duration", "1ms"}, exitOK, []string{"discover"}},
+		{"scan bad duration", []string{"scan", "--duration", "-1s"}, exitUsage, nil},
+		{"scan bad filter", []string{"scan", "rssi=-70", "pathloss=80"}, exitUsage, nil},
+		{"adapter set", []string{"adapter", "set", "discoverable=on", "discoverable-timeout=300"}, exitOK, []string{"configure-adapter discoverable=on discoverable-timeout=5m"}},
+		{"adapter set alias", []string{"adapter", "set", "alias=work laptop"}, exitOK, []string{"configure-adapter alias=work laptop"}},
+		{"adapter set nothing", []string{"adapter", "set"}, exitUsage, nil},
+		{"adapter set unknown key", []string{"adapter", "set", "visible=on"}, exitUsage, nil},
+		{"adapter set bad value", []string{"adapter", "set", "pairable=maybe"}, exitUsage, nil},
+		{"adapter bad subcommand", []string{"adapter", "reset"}, exitUsage, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newFakeBackend()
+			code, _, stderr := runCLIForTest(b, tc.args...)
+			if code != tc.want {
+				t.Fatalf("exit code = %d, want %d (stderr: %s)", code, tc.want, stderr)
+			}
+			if strings.Join(b.calls, ",") != strings.Join(tc.calls, ",") {
+				t.Errorf("calls = %v, want %v", b.calls, tc.calls)
+			}
+		})
+	}
+}
+
+func TestCLIBackendFailure(t *testing.T) {
+	b := newFakeBackend()
+	b.err = errors.New("org.bluez.Error.Failed")
+	code, _, stderr := runCLIForTest(b, "connect", testMACMouse)
+	if code != exitFailure {
+		t.Errorf("exit code = %d, want %d", code, exitFailure)
+	}
+	if !strings.Contains(stderr, "org.bluez.Error.Failed") {
+		t.Errorf("stderr = %q, want backend error", stderr)
+	}
+}
+
+func TestCLIStatus(t *testing.T) {
+	code, stdout, _ := runCLIForTest(newFakeBackend(), "status")
+	if code != exitOK {
+		t.Fatalf("exit code = %d", code)
+	}
+	want := "Bluetooth: on\nConnected: WH-1000XM4 (" + testMACHeadphones + ")\n"
+	if stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+}
+
+func TestCLIOutputFormats(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "list json",
+			args: []string{"list", "--json"},
+			want: `{"schema_version":1,"devices":[` +
+				`{"mac":"AA:BB:CC:DD:EE:FF","name":"WH-1000XM4","connected":true,"paired":true,"trusted":true,"blocked":false,"category":"audio-headset","battery":null,"rssi":null,"tx_power":null,"uuids":[],"alias":""},` +
+				`{"mac":"11:22:33:44:55:66","name":"MX Master 3","connected":false,"paired":true,"trusted":false,"blocked":false,"category":"input-mouse","battery":null,"rssi":null,"tx_power":null,"uuids":[],"alias":""},` +
+				`{"mac":"22:33:44:55:66:77","name":"MX Keys","connected":false,"paired":false,"trusted":false,"blocked":false,"category":"input-keyboard","battery":null,"rssi":null,"tx_power":null,"uuids":[],"alias":""}]}` + "\n",
+		},
+		{
+			name: "list tsv",
+			args: []string{"list", "--format=tsv"},
+			want: "AA:BB:CC:DD:EE:FF\tWH-1000XM4\tyes\tyes\tyes\tno\t\t\t\taudio-headset\t\n" +
+				"11:22:33:44:55:66\tMX Master 3\tno\tyes\tno\tno\t\t\t\tinput-mouse\t\n" +
+				"22:33:44:55:66:77\tMX Keys\tno\tno\tno\tno\t\t\t\tinput-keyboard\t\n",
+		},
+		{
+			name: "status json",
+			args: []string{"status", "--format", "json"},
+			want: `{"schema_version":1,"adapter":{"powered":true},"connected":[` +
+				`{"mac":"AA:BB:CC:DD:EE:FF","name":"WH-1000XM4","connected":true,"paired":true,"trusted":true,"blocked":false,"category":"audio-headset","battery":null,"rssi":null,"tx_power":null,"uuids":[],"alias":""}]}` + "\n",
+		},
+		{
+			name: "status tsv",
+			args: []string{"status", "--format", "tsv"},
+			want: "powered\tyes\nAA:BB:CC:DD:EE:FF\tWH-1000XM4\tyes\tyes\tyes\tno\t\t\t\taudio-headset\t\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			code, stdout, stderr := runCLIForTest(newFakeBackend(), tc.args...)
+			if code != exitOK {
+				t.Fatalf("exit code = %d (stderr: %s)", code, stderr)
+			}
+			if stdout != tc.want {
+				t.Errorf("stdout =\n%s\nwant\n%s", stdout, tc.want)
+			}
+		})
+	}
+}
+
+func TestCLIProfiles(t *testing.T) {
+	b := newFakeBackend()
+	b.devices[0].UUIDs = []string{testUUIDA2DP, testUUIDHFP}
+	code, stdout, stderr := runCLIForTest(b, "profiles", "--format=tsv", "WH-1000XM4")
+	if code != exitOK {
+		t.Fatalf("exit code = %d (stderr: %s)", code, stderr)
+	}
+	want := testUUIDA2DP + "\tA2DP\tAudio Sink\n" + testUUIDHFP + "\tHFP\tHandsfree\n"
+	if stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+}
+
+func TestCLIAdapters(t *testing.T) {
+	code, stdout, _ := runCLIForTest(newFakeBackend(), "adapters", "--format=tsv")
+	if code != exitOK {
+		t.Fatalf("exit code = %d", code)
+	}
+	want := "00:1A:7D:DA:71:13\tlaptop\tyes\tyes\tno\tyes\t180\t0\n5C:F3:70:8B:12:34\tdongle\tno\tno\tno\tno\t0\t0\n"
+	if stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+}
+
+func TestCLIAdapterShow(t *testing.T) {
+	b := newFakeBackend()
+	b.WithAdapter("5C:F3:70:8B:12:34")
+	if code, _, stderr := runCLIForTest(b, "adapter", "set", "pairable=on", "pairable-timeout=1m"); code != exitOK {
+		t.Fatalf("set: exit code = %d (stderr: %s)", code, stderr)
+	}
+	code, stdout, _ := runCLIForTest(b, "adapter", "show", "--json")
+	if code != exitOK {
+		t.Fatalf("show: exit code = %d", code)
+	}
+	want := `{"schema_version":1,"adapter":{"mac":"5C:F3:70:8B:12:34","name":"dongle","powered":false,"default":false,` +
+		`"discoverable":false,"pairable":true,"discoverable_timeout":0,"pairable_timeout":60}}` + "\n"
+	if stdout != want {
+		t.Errorf("stdout = %s, want %s", stdout, want)
+	}
+}
+
+func TestCLIScanFilter(t *testing.T) {
+	b := newFakeBackend()
+	b.devices[1].RSSI, b.devices[1].HasRSSI = -85, true
+	code, stdout, stderr := runCLIForTest(b, "scan", "--duration=1ms", "--format=tsv", "name=^mx", "rssi=-70")
+	if code != exitOK {
+		t.Fatalf("exit code = %d (stderr: %s)", code, stderr)
+	}
+	want := "22:33:44:55:66:77\tMX Keys\tno\tno\tno\tno\t\t\t\tinput-keyboard\t\n"
+	if stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+}
+
+func TestSelectAdapter(t *testing.T) {
+	ctx := context.Background()
+	b := newFakeBackend()
+	if _, mac, err := selectAdapter(ctx, b, "Dongle"); err != nil || mac != "5C:F3:70:8B:12:34" || b.adapter != mac {
+		t.Errorf("by name: mac %q, selected %q, err %v", mac, b.adapter, err)
+	}
+	if _, _, err := selectAdapter(ctx, b, "00:1a:7d:da:71:13"); err != nil || b.adapter != "00:1A:7D:DA:71:13" {
+		t.Errorf("by MAC: selected %q, err %v", b.adapter, err)
+	}
+	if _, _, err := selectAdapter(ctx, b, "usb"); exitCode(err) != exitNotFound {
+		t.Errorf("unknown adapter: got %v, want not found", err)
+	}
+}
+
+func TestCLIOutputFormatErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"list", "--format=xml"},
+		{"status", "--json", "--format=tsv"},
+	} {
+		if code, _, _ := runCLIForTest(newFakeBackend(), args...); code != exitUsage {
+			t.Errorf("%v: exit code = %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func TestCLIEmptyListJSON(t *testing.T) {
+	b := newFakeBackend()
+	b.devices = nil
+	_, stdout, _ := runCLIForTest(b, "list", "--json")
+	if stdout != `{"schema_version":1,"devices":[]}`+"\n" {
+		t.Errorf("stdout = %q, want an empty devices array", stdout)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config is what config.toml can set. Flags and environment variables
+// take precedence over it.
+type Config struct {
+	Backend string `toml:"backend"`
+	Adapter string `toml:"adapter"`
+	// LowBattery is the battery percentage at or below which a connected
+	// device is flagged.
+	LowBattery int `toml:"low_battery"`
+	// ScanDuration stops discovery in the TUI after this long; 0 scans
+	// until stopped.
+	ScanDuration time.Duration `toml:"scan_duration"`
+	// InfoConcurrency is how many devices the bluetoothctl backend queries
+	// at once when listing them.
+	InfoConcurrency int      `toml:"info_concurrency"`
+	Timeouts        Timeouts `toml:"timeouts"`
+	// ASCII draws plain ASCII instead of emoji and symbols; unset guesses
+	// from the terminal.
+	ASCII *bool `toml:"ascii"`
+	// Theme is a built-in theme or a user theme; Colors override it.
+	Theme  string            `toml:"theme"`
+	Colors map[string]string `toml:"colors"`
+	// Keys rebinds actions, e.g. scan = ["s", "ctrl+s"].
+	Keys map[string]keyList `toml:"keys"`
+
+	// themesDir is where user themes are looked up, next to the file.
+	themesDir string
+}
+
+// Timeouts bound each kind of operation.
+type Timeouts struct {
+	// Command bounds a single backend call such as connect or list.
+	Command time.Duration `toml:"command"`
+	// Pair bounds pairing, which waits on the user and the device.
+	Pair time.Duration `toml:"pair"`
+	// PostPairConnect is the pause between pairing and connecting, which
+	// some devices need.
+	PostPairConnect time.Duration `toml:"post_pair_connect"`
+	// Agent is how long a pairing prompt waits for an answer.
+	Agent time.Duration `toml:"agent"`
+	// Scan is how long `hyprBluetooth scan` scans without --duration.
+	Scan time.Duration `toml:"scan"`
+}
+
+var defaultTimeouts = Timeouts{
+	Command:         cmdTimeout,
+	Pair:            pairCmdTimeout,
+	PostPairConnect: postPairConnectDelay,
+	Agent:           agentTimeout,
+	Scan:            scanDuration,
+}
+
+func defaultConfig() Config {
+	return Config{
+		Backend:         backendAuto,
+		LowBattery:      lowBatteryThreshold,
+		InfoConcurrency: infoFetchConcurrency,
+		Timeouts:        defaultTimeouts,
+		Theme:           "default",
+	}
+}
+
+// defaultConfigPath is $XDG_CONFIG_HOME/hyprBluetooth/config.toml, falling
+// back to ~/.config as the XDG spec says.
+func defaultConfigPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "hyprBluetooth", "config.toml"), nil
+}
+
+// loadConfig reads path over the defaults. A missing file is fine unless
+// the user named it.
+func loadConfig(path string, required bool) (Config, error) {
+	cfg := defaultConfig()
+	cfg.themesDir = filepath.Join(filepath.Dir(path), "themes")
+	md, err := toml.DecodeFile(path, &cfg)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("failed to load config %s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		return cfg, fmt.Errorf("config %s: unknown setting %s", path, strings.Join(keys, ", "))
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (c Config) validate() error {
+	switch c.Backend {
+	case backendAuto, backendDBus, backendBluetoothctl:
+	default:
+		return fmt.Errorf("invalid backend %q; use %s, %s or %s", c.Backend, backendAuto, backendDBus, backendBluetoothctl)
+	}
+	if c.LowBattery < 0 || c.LowBattery > 100 {
+		return fmt.Errorf("low_battery must be between 0 and 100, got %d", c.LowBattery)
+	}
+	if c.InfoConcurrency < 1 || c.InfoConcurrency > 64 {
+		return fmt.Errorf("info_concurrency must be between 1 and 64, got %d", c.InfoConcurrency)
+	}
+	// A bare number decodes as nanoseconds, so a minimum of a second also
+	// catches "command = 15".
+	if c.ScanDuration != 0 && c.ScanDuration < time.Second {
+		return fmt.Errorf("scan_duration must be 0 or at least 1s, got %s; write durations as strings such as \"30s\"", c.ScanDuration)
+	}
+	for _, t := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"timeouts.command", c.Timeouts.Command},
+		{"timeouts.pair", c.Timeouts.Pair},
+		{"timeouts.agent", c.Timeouts.Agent},
+		{"timeouts.scan", c.Timeouts.Scan},
+	} {
+		if t.d < time.Second {
+			return fmt.Errorf("%s must be at least 1s, got %s; write durations as strings such as \"15s\"", t.name, t.d)
+		}
+	}
+	if c.Timeouts.PostPairConnect < 0 {
+		return fmt.Errorf("timeouts.post_pair_connect must not be negative, got %s", c.Timeouts.PostPairConnect)
+	}
+	if _, err := c.palette(); err != nil {
+		return err
+	}
+	if _, err := newKeymap(c.Keys); err != nil {
+		return fmt.Errorf("keys: %w", err)
+	}
+	return nil
+}
+
+// palette is the theme with Colors applied.
+func (c Config) palette() (palette, error) {
+	p, err := loadTheme(c.Theme, c.themesDir)
+	if err != nil {
+		return p, err
+	}
+	return p.withColors(c.Colors)
+}
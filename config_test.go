@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		toml    string
+		wantErr string
+		check   func(t *testing.T, cfg Config)
+	}{
+		{
+			name: "empty file keeps defaults",
+			check: func(t *testing.T, cfg Config) {
+				if cfg.Backend != backendAuto || cfg.Timeouts != defaultTimeouts || cfg.InfoConcurrency != infoFetchConcurrency {
+					t.Errorf("cfg = %+v", cfg)
+				}
+			},
+		},
+		{
+			name: "overrides",
+			toml: `backend = "bluetoothctl"
+low_battery = 30
+scan_duration = "45s"
+info_concurrency = 8
+
+[timeouts]
+command = "20s"
+post_pair_connect = "0s"
+
+[colors]
+accent = "#112233"
+muted = "245"
+
+[keys]
+scan = ["s", "ctrl+s"]
+quit = "Q"
+`,
+			check: func(t *testing.T, cfg Config) {
+				if cfg.Backend != backendBluetoothctl || cfg.LowBattery != 30 || cfg.ScanDuration != 45*time.Second || cfg.InfoConcurrency != 8 {
+					t.Errorf("cfg = %+v", cfg)
+				}
+				want := defaultTimeouts
+				want.Command, want.PostPairConnect = 20*time.Second, 0
+				if cfg.Timeouts != want {
+					t.Errorf("timeouts = %+v, want %+v", cfg.Timeouts, want)
+				}
+				p, err := defaultPalette.withColors(cfg.Colors)
+				if err != nil || p.Accent != lipgloss.Color("#112233") || p.Muted != lipgloss.Color("245") || p.Success != defaultPalette.Success {
+					t.Errorf("palette = %+v, %v", p, err)
+				}
+				if !reflect.DeepEqual(cfg.Keys, map[string]keyList{"scan": {"s", "ctrl+s"}, "quit": {"Q"}}) {
+					t.Errorf("keys = %v", cfg.Keys)
+				}
+			},
+		},
+		{name: "unknown key", toml: "backend = \"dbus\"\nbakend = \"dbus\"\n", wantErr: "unknown setting bakend"},
+		{name: "bad backend", toml: `backend = "hci"`, wantErr: "invalid backend"},
+		{name: "bad low battery", toml: "low_battery = 120", wantErr: "low_battery"},
+		{name: "bare number timeout", toml: "[timeouts]\ncommand = 15\n", wantErr: "timeouts.command must be at least 1s"},
+		{name: "bare number scan duration", toml: "scan_duration = 30", wantErr: "scan_duration must be 0 or at least 1s"},
+		{name: "negative scan duration", toml: `scan_duration = "-5s"`, wantErr: "scan_duration must be 0 or at least 1s"},
+		{name: "bad duration", toml: "[timeouts]\npair = \"soon\"\n", wantErr: "failed to load config"},
+		{name: "bad concurrency", toml: "info_concurrency = 0", wantErr: "info_concurrency"},
+		{name: "bad color", toml: "[colors]\naccent = \"purple\"\n", wantErr: "invalid color accent"},
+		{name: "key conflict", toml: "[keys]\nscan = \"p\"\n", wantErr: `keys: key "p" is bound to both`},
+		{name: "bad key list", toml: "[keys]\nscan = 5\n", wantErr: "expected a key name"},
+		{name: "unknown color", toml: "[colors]\nbackground = \"#000000\"\n", wantErr: "unknown color"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte(tc.toml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := loadConfig(path, true)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("loadConfig error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if _, err := loadConfig(path, false); err != nil {
+		t.Errorf("missing default config: %v", err)
+	}
+	if _, err := loadConfig(path, true); err == nil {
+		t.Error("missing --config file was accepted")
+	}
+}
+
+func TestConfigTheme(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	if err := os.MkdirAll(filepath.Join(dir, "themes"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "themes", "mine.toml"), []byte(`success = "#00FF00"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("theme = \"mine\"\n[colors]\nerror = \"1\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := cfg.palette()
+	if err != nil || p.Success != lipgloss.Color("#00FF00") || p.Error != lipgloss.Color("1") {
+		t.Errorf("palette = %+v, %v", p, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`theme = "missing"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path, true); err == nil || !strings.Contains(err.Error(), "unknown theme") {
+		t.Errorf("loadConfig with a missing theme: %v", err)
+	}
+}
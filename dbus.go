@@ -0,0 +1,761 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	bluezService      = "org.bluez"
+	bluezAdapterIface = "org.bluez.Adapter1"
+	bluezDeviceIface  = "org.bluez.Device1"
+	bluezBatteryIface = "org.bluez.Battery1"
+
+	dbusObjectManagerIface = "org.freedesktop.DBus.ObjectManager"
+	dbusPropertiesIface    = "org.freedesktop.DBus.Properties"
+)
+
+// managedObjects is the reply shape of ObjectManager.GetManagedObjects.
+type managedObjects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+
+// busConn is the subset of *dbus.Conn the D-Bus backend uses, so tests can
+// substitute an in-process fake BlueZ service.
+type busConn interface {
+	Object(dest string, path dbus.ObjectPath) dbus.BusObject
+	AddMatchSignalContext(ctx context.Context, options ...dbus.MatchOption) error
+	RemoveMatchSignalContext(ctx context.Context, options ...dbus.MatchOption) error
+	Signal(ch chan<- *dbus.Signal)
+	RemoveSignal(ch chan<- *dbus.Signal)
+	Export(v interface{}, path dbus.ObjectPath, iface string) error
+}
+
+type dbusBackend struct {
+	conn busConn
+	// adapterMAC selects a controller by address; empty means the default.
+	adapterMAC string
+	// agentTimeout is how long a pairing prompt waits; 0 means
+	// agentTimeout.
+	agentTimeout time.Duration
+	// commandTimeout bounds the cleanup calls made once a caller's context
+	// is done; 0 means cmdTimeout.
+	commandTimeout time.Duration
+}
+
+func newDBusBackend(t Timeouts) (*dbusBackend, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system bus: %w", err)
+	}
+	var hasOwner bool
+	err = conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, bluezService).Store(&hasOwner)
+	if err != nil || !hasOwner {
+		_ = conn.Close()
+		return nil, errors.New("bluetoothd is not running on the system bus")
+	}
+	return &dbusBackend{conn: conn, agentTimeout: t.Agent, commandTimeout: t.Command}, nil
+}
+
+func (b *dbusBackend) managedObjects(ctx context.Context) (managedObjects, error) {
+	var objs managedObjects
+	err := b.conn.Object(bluezService, "/").
+		CallWithContext(ctx, dbusObjectManagerIface+".GetManagedObjects", 0).
+		Store(&objs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bluez objects: %w", err)
+	}
+	return objs, nil
+}
+
+// adapterPaths lists adapters in path order; the first is the one
+// bluetoothctl treats as the default controller.
+func adapterPaths(objs managedObjects) []dbus.ObjectPath {
+	var paths []string
+	for path, ifaces := range objs {
+		if _, ok := ifaces[bluezAdapterIface]; ok {
+			paths = append(paths, string(path))
+		}
+	}
+	sort.Strings(paths)
+	out := make([]dbus.ObjectPath, 0, len(paths))
+	for _, path := range paths {
+		out = append(out, dbus.ObjectPath(path))
+	}
+	return out
+}
+
+// adapterPath returns the adapter with address mac, or the default adapter
+// when mac is empty.
+func adapterPath(objs managedObjects, mac string) (dbus.ObjectPath, error) {
+	paths := adapterPaths(objs)
+	if len(paths) == 0 {
+		return "", errors.New("no bluetooth adapter found")
+	}
+	if mac == "" {
+		return paths[0], nil
+	}
+	for _, path := range paths {
+		if strings.EqualFold(variantString(objs[path][bluezAdapterIface]["Address"]), mac) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("adapter %s not found", mac)
+}
+
+func (b *dbusBackend) adapter(ctx context.Context) (dbus.ObjectPath, error) {
+	objs, err := b.managedObjects(ctx)
+	if err != nil {
+		return "", err
+	}
+	return adapterPath(objs, b.adapterMAC)
+}
+
+func (b *dbusBackend) Adapters(ctx context.Context) ([]Adapter, error) {
+	objs, err := b.managedObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var adapters []Adapter
+	for i, path := range adapterPaths(objs) {
+		a := adapterFromProps(objs[path][bluezAdapterIface])
+		a.Default = i == 0
+		adapters = append(adapters, a)
+	}
+	return adapters, nil
+}
+
+func adapterFromProps(props map[string]dbus.Variant) Adapter {
+	return Adapter{
+		MAC:                 variantString(props["Address"]),
+		Name:                variantString(props["Alias"]),
+		Powered:             variantBool(props["Powered"]),
+		Discoverable:        variantBool(props["Discoverable"]),
+		Pairable:            variantBool(props["Pairable"]),
+		DiscoverableTimeout: variantSeconds(props["DiscoverableTimeout"]),
+		PairableTimeout:     variantSeconds(props["PairableTimeout"]),
+	}
+}
+
+func (b *dbusBackend) WithAdapter(mac string) Backend {
+	return &dbusBackend{conn: b.conn, adapterMAC: mac, agentTimeout: b.agentTimeout, commandTimeout: b.commandTimeout}
+}
+
+func (b *dbusBackend) AdapterInfo(ctx context.Context) (Adapter, error) {
+	objs, err := b.managedObjects(ctx)
+	if err != nil {
+		return Adapter{}, fmt.Errorf("failed to get adapter info: %w", err)
+	}
+	path, err := adapterPath(objs, b.adapterMAC)
+	if err != nil {
+		return Adapter{}, err
+	}
+	a := adapterFromProps(objs[path][bluezAdapterIface])
+	a.Default = path == adapterPaths(objs)[0]
+	return a, nil
+}
+
+// ConfigureAdapter sets the timeouts before switching discoverable or
+// pairable on, so the new timeout covers this window.
+func (b *dbusBackend) ConfigureAdapter(ctx context.Context, s AdapterSettings) error {
+	adapter, err := b.adapter(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to configure adapter: %w", err)
+	}
+	type prop struct {
+		name  string
+		value any
+	}
+	var props []prop
+	if s.Alias != nil {
+		props = append(props, prop{"Alias", *s.Alias})
+	}
+	if s.PairableTimeout != nil {
+		props = append(props, prop{"PairableTimeout", uint32(*s.PairableTimeout / time.Second)})
+	}
+	if s.Pairable != nil {
+		props = append(props, prop{"Pairable", *s.Pairable})
+	}
+	if s.DiscoverableTimeout != nil {
+		props = append(props, prop{"DiscoverableTimeout", uint32(*s.DiscoverableTimeout / time.Second)})
+	}
+	if s.Discoverable != nil {
+		props = append(props, prop{"Discoverable", *s.Discoverable})
+	}
+	obj := b.conn.Object(bluezService, adapter)
+	for _, p := range props {
+		if err := setProperty(ctx, obj, bluezAdapterIface, p.name, p.value); err != nil {
+			return fmt.Errorf("failed to set adapter %s: %w", p.name, err)
+		}
+	}
+	return nil
+}
+
+// devicePath builds the object path BlueZ assigns to a device on an adapter.
+func devicePath(adapter dbus.ObjectPath, mac string) dbus.ObjectPath {
+	return adapter + "/dev_" + dbus.ObjectPath(strings.ReplaceAll(strings.ToUpper(mac), ":", "_"))
+}
+
+func (b *dbusBackend) device(ctx context.Context, mac string) (dbus.BusObject, error) {
+	if err := validateMAC(mac); err != nil {
+		return nil, err
+	}
+	adapter, err := b.adapter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return b.conn.Object(bluezService, devicePath(adapter, mac)), nil
+}
+
+func variantString(v dbus.Variant) string {
+	s, _ := v.Value().(string)
+	return s
+}
+
+func variantBool(v dbus.Variant) bool {
+	b, _ := v.Value().(bool)
+	return b
+}
+
+// variantSeconds reads the uint32 second counts BlueZ uses for timeouts.
+func variantSeconds(v dbus.Variant) time.Duration {
+	n, _ := v.Value().(uint32)
+	return time.Duration(n) * time.Second
+}
+
+// variantInt16 reports whether v holds an int16, which is how BlueZ types
+// RSSI and TxPower; both are absent when not known.
+func variantInt16(v dbus.Variant) (int, bool) {
+	n, ok := v.Value().(int16)
+	return int(n), ok
+}
+
+// deviceFromObject builds a device from its Device1 properties plus the
+// Battery1 interface BlueZ adds for devices that report a charge level.
+func deviceFromObject(ifaces map[string]map[string]dbus.Variant) BluetoothDevice {
+	d := deviceFromProps(ifaces[bluezDeviceIface])
+	if v, ok := ifaces[bluezBatteryIface]["Percentage"]; ok {
+		if pct, ok := v.Value().(byte); ok {
+			d.Battery, d.HasBattery = int(pct), true
+		}
+	}
+	return d
+}
+
+func deviceFromProps(props map[string]dbus.Variant) BluetoothDevice {
+	d := BluetoothDevice{
+		MAC:           variantString(props["Address"]),
+		Name:          variantString(props["Name"]),
+		Alias:         variantString(props["Alias"]),
+		AddressType:   variantString(props["AddressType"]),
+		Connected:     variantBool(props["Connected"]),
+		Paired:        variantBool(props["Paired"]),
+		Bonded:        variantBool(props["Bonded"]),
+		Trusted:       variantBool(props["Trusted"]),
+		Blocked:       variantBool(props["Blocked"]),
+		LegacyPairing: variantBool(props["LegacyPairing"]),
+		Modalias:      variantString(props["Modalias"]),
+	}
+	d.Icon = variantString(props["Icon"])
+	d.UUIDs, _ = props["UUIDs"].Value().([]string)
+	d.Class, _ = props["Class"].Value().(uint32)
+	d.Appearance, _ = props["Appearance"].Value().(uint16)
+	d.RSSI, d.HasRSSI = variantInt16(props["RSSI"])
+	d.TxPower, d.HasTxPower = variantInt16(props["TxPower"])
+	return d
+}
+
+func (b *dbusBackend) ListDevices(ctx context.Context) ([]BluetoothDevice, error) {
+	objs, err := b.managedObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	adapter, err := adapterPath(objs, b.adapterMAC)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(objs))
+	for path := range objs {
+		paths = append(paths, string(path))
+	}
+	sort.Strings(paths)
+
+	var devices []BluetoothDevice
+	for _, path := range paths {
+		ifaces := objs[dbus.ObjectPath(path)]
+		props, ok := ifaces[bluezDeviceIface]
+		if !ok {
+			continue
+		}
+		if owner, _ := props["Adapter"].Value().(dbus.ObjectPath); owner != adapter {
+			continue
+		}
+		d := deviceFromObject(ifaces)
+		if macRegex.MatchString(d.MAC) {
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+func (b *dbusBackend) DeviceInfo(ctx context.Context, mac string) (BluetoothDevice, error) {
+	obj, err := b.device(ctx, mac)
+	if err != nil {
+		return BluetoothDevice{}, err
+	}
+	d, err := readDevice(ctx, obj)
+	if err != nil {
+		return BluetoothDevice{}, fmt.Errorf("failed to get device info: %w", err)
+	}
+	d.MAC = mac
+	return d, nil
+}
+
+// readDevice fetches a device object's current state. Battery1 is optional,
+// so only a Device1 failure is an error.
+func readDevice(ctx context.Context, obj dbus.BusObject) (BluetoothDevice, error) {
+	ifaces, err := readObject(ctx, obj)
+	if err != nil {
+		return BluetoothDevice{}, err
+	}
+	return deviceFromObject(ifaces), nil
+}
+
+// readObject reads the interfaces a BluetoothDevice is built from; a
+// device without a battery has no Battery1.
+func readObject(ctx context.Context, obj dbus.BusObject) (map[string]map[string]dbus.Variant, error) {
+	ifaces := map[string]map[string]dbus.Variant{}
+	for _, iface := range []string{bluezDeviceIface, bluezBatteryIface} {
+		var props map[string]dbus.Variant
+		err := obj.CallWithContext(ctx, dbusPropertiesIface+".GetAll", 0, iface).Store(&props)
+		if err != nil {
+			if iface == bluezDeviceIface {
+				return nil, err
+			}
+			continue
+		}
+		ifaces[iface] = props
+	}
+	return ifaces, nil
+}
+
+func (b *dbusBackend) callDevice(ctx context.Context, mac, method, action string, args ...any) error {
+	obj, err := b.device(ctx, mac)
+	if err != nil {
+		return err
+	}
+	if err := obj.CallWithContext(ctx, bluezDeviceIface+"."+method, 0, args...).Err; err != nil {
+		return fmt.Errorf("failed to %s device %s: %w", action, mac, err)
+	}
+	return nil
+}
+
+func (b *dbusBackend) Connect(ctx context.Context, mac string) error {
+	return b.callDevice(ctx, mac, "Connect", "connect to")
+}
+
+func (b *dbusBackend) Disconnect(ctx context.Context, mac string) error {
+	return b.callDevice(ctx, mac, "Disconnect", "disconnect from")
+}
+
+func (b *dbusBackend) ConnectProfile(ctx context.Context, mac, uuid string) error {
+	return b.callDevice(ctx, mac, "ConnectProfile", "connect profile "+uuid+" on", uuid)
+}
+
+func (b *dbusBackend) DisconnectProfile(ctx context.Context, mac, uuid string) error {
+	return b.callDevice(ctx, mac, "DisconnectProfile", "disconnect profile "+uuid+" on", uuid)
+}
+
+func (b *dbusBackend) Pair(ctx context.Context, mac string) error {
+	return b.callDevice(ctx, mac, "Pair", "pair with")
+}
+
+func (b *dbusBackend) setDeviceFlag(ctx context.Context, mac, prop string, value bool, action string) error {
+	obj, err := b.device(ctx, mac)
+	if err != nil {
+		return err
+	}
+	if err := setProperty(ctx, obj, bluezDeviceIface, prop, value); err != nil {
+		return fmt.Errorf("failed to %s device %s: %w", action, mac, err)
+	}
+	return nil
+}
+
+func (b *dbusBackend) Trust(ctx context.Context, mac string) error {
+	return b.setDeviceFlag(ctx, mac, "Trusted", true, "trust")
+}
+
+func (b *dbusBackend) Untrust(ctx context.Context, mac string) error {
+	return b.setDeviceFlag(ctx, mac, "Trusted", false, "untrust")
+}
+
+func (b *dbusBackend) Block(ctx context.Context, mac string) error {
+	return b.setDeviceFlag(ctx, mac, "Blocked", true, "block")
+}
+
+func (b *dbusBackend) Unblock(ctx context.Context, mac string) error {
+	return b.setDeviceFlag(ctx, mac, "Blocked", false, "unblock")
+}
+
+func (b *dbusBackend) Remove(ctx context.Context, mac string) error {
+	if err := validateMAC(mac); err != nil {
+		return err
+	}
+	adapter, err := b.adapter(ctx)
+	if err != nil {
+		return err
+	}
+	err = b.conn.Object(bluezService, adapter).
+		CallWithContext(ctx, bluezAdapterIface+".RemoveDevice", 0, devicePath(adapter, mac)).Err
+	if err != nil {
+		return fmt.Errorf("failed to remove device %s: %w", mac, err)
+	}
+	return nil
+}
+
+// SetAlias sets Alias, which BlueZ resets to the device's name when given
+// "".
+func (b *dbusBackend) SetAlias(ctx context.Context, mac, alias string) error {
+	obj, err := b.device(ctx, mac)
+	if err != nil {
+		return err
+	}
+	if err := setProperty(ctx, obj, bluezDeviceIface, "Alias", alias); err != nil {
+		return fmt.Errorf("failed to rename device %s: %w", mac, err)
+	}
+	return nil
+}
+
+func (b *dbusBackend) Powered(ctx context.Context) (bool, error) {
+	adapter, err := b.adapter(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get bluetooth status: %w", err)
+	}
+	var v dbus.Variant
+	err = b.conn.Object(bluezService, adapter).
+		CallWithContext(ctx, dbusPropertiesIface+".Get", 0, bluezAdapterIface, "Powered").
+		Store(&v)
+	if err != nil {
+		return false, fmt.Errorf("failed to get bluetooth status: %w", err)
+	}
+	powered, ok := v.Value().(bool)
+	if !ok {
+		return false, errors.New("could not determine bluetooth status")
+	}
+	return powered, nil
+}
+
+func (b *dbusBackend) Power(ctx context.Context, on bool) error {
+	state := "disable"
+	if on {
+		state = "enable"
+	}
+	adapter, err := b.adapter(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to %s bluetooth: %w", state, err)
+	}
+	if err := setProperty(ctx, b.conn.Object(bluezService, adapter), bluezAdapterIface, "Powered", on); err != nil {
+		return fmt.Errorf("failed to %s bluetooth: %w", state, err)
+	}
+	return nil
+}
+
+// Discover subscribes to device signals before starting discovery so that
+// nothing found in between is missed. Discovery is always stopped, even if
+// ctx is canceled before the subscription ends.
+func (b *dbusBackend) Discover(ctx context.Context, filter DiscoveryFilter) (<-chan BluetoothDevice, error) {
+	adapter, err := b.adapter(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start scan: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	events, err := b.Events(ctx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start scan: %w", err)
+	}
+	obj := b.conn.Object(bluezService, adapter)
+	// An empty filter clears whatever an earlier scan set.
+	if err := obj.CallWithContext(ctx, bluezAdapterIface+".SetDiscoveryFilter", 0, discoveryFilterArgs(filter)).Err; err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to set discovery filter: %w", err)
+	}
+	if err := obj.CallWithContext(ctx, bluezAdapterIface+".StartDiscovery", 0).Err; err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start scan: %w", err)
+	}
+
+	out := make(chan BluetoothDevice)
+	go func() {
+		defer close(out)
+		defer func() {
+			cancel()
+			// Use Background so we still stop scanning once ctx is canceled.
+			stopCtx, cancelStop := context.WithTimeout(context.Background(), cmp.Or(b.commandTimeout, cmdTimeout))
+			defer cancelStop()
+			_ = obj.CallWithContext(stopCtx, bluezAdapterIface+".StopDiscovery", 0).Err
+		}()
+		for ev := range events {
+			if ev.Kind != EventDeviceAdded && ev.Kind != EventDeviceChanged {
+				continue
+			}
+			select {
+			case out <- ev.Device:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// discoveryFilterArgs builds the SetDiscoveryFilter dictionary, leaving out
+// whatever the filter doesn't set.
+func discoveryFilterArgs(f DiscoveryFilter) map[string]dbus.Variant {
+	args := map[string]dbus.Variant{}
+	if f.Transport != "" {
+		args["Transport"] = dbus.MakeVariant(f.Transport)
+	}
+	if f.MinRSSI != 0 {
+		args["RSSI"] = dbus.MakeVariant(int16(f.MinRSSI))
+	}
+	if f.Pathloss != 0 {
+		args["Pathloss"] = dbus.MakeVariant(uint16(f.Pathloss))
+	}
+	if len(f.UUIDs) > 0 {
+		args["UUIDs"] = dbus.MakeVariant(f.UUIDs)
+	}
+	if f.DuplicateData != nil {
+		args["DuplicateData"] = dbus.MakeVariant(*f.DuplicateData)
+	}
+	return args
+}
+
+// Events subscribes to BlueZ's ObjectManager and PropertiesChanged signals
+// and translates them into Events for the selected adapter, or the default
+// one when none is. The match rules are removed again when the stream
+// ends, since Discover subscribes anew for every scan and the bus limits
+// rules per connection.
+func (b *dbusBackend) Events(ctx context.Context) (<-chan Event, error) {
+	objs, err := b.managedObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	adapter, err := adapterPath(objs, b.adapterMAC)
+	if err != nil {
+		return nil, err
+	}
+	matches := [][]dbus.MatchOption{
+		{dbus.WithMatchSender(bluezService), dbus.WithMatchInterface(dbusObjectManagerIface)},
+		{
+			dbus.WithMatchSender(bluezService),
+			dbus.WithMatchInterface(dbusPropertiesIface),
+			dbus.WithMatchMember("PropertiesChanged"),
+			dbus.WithMatchPathNamespace(adapter),
+		},
+	}
+	for i, opts := range matches {
+		if err := b.conn.AddMatchSignalContext(ctx, opts...); err != nil {
+			b.removeMatches(matches[:i])
+			return nil, fmt.Errorf("failed to subscribe to bluez signals: %w", err)
+		}
+	}
+
+	stream := newEventStream(b, adapter, objs)
+	signals := make(chan *dbus.Signal, 16)
+	b.conn.Signal(signals)
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		defer b.removeMatches(matches)
+		defer b.conn.RemoveSignal(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig, ok := <-signals:
+				if !ok {
+					return // the connection dropped
+				}
+				ev, ok := stream.event(ctx, sig)
+				if !ok {
+					continue
+				}
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// removeMatches drops match rules added by Events. It runs once the
+// stream's ctx is done, so it gets a context of its own.
+func (b *dbusBackend) removeMatches(matches [][]dbus.MatchOption) {
+	ctx, cancel := context.WithTimeout(context.Background(), cmp.Or(b.commandTimeout, cmdTimeout))
+	defer cancel()
+	for _, opts := range matches {
+		_ = b.conn.RemoveMatchSignalContext(ctx, opts...)
+	}
+}
+
+// eventStream turns the signals for one adapter into Events. It keeps the
+// properties of the adapter's devices and applies each PropertiesChanged
+// signal to them, so events carry full device state without a GetAll per
+// interface for every signal; during a scan there is one for every
+// advertisement.
+type eventStream struct {
+	b       *dbusBackend
+	adapter dbus.ObjectPath
+	devices managedObjects
+}
+
+func newEventStream(b *dbusBackend, adapter dbus.ObjectPath, objs managedObjects) *eventStream {
+	s := &eventStream{b: b, adapter: adapter, devices: managedObjects{}}
+	for path, ifaces := range objs {
+		if _, ok := ifaces[bluezDeviceIface]; ok && isAdapterChild(adapter, path) {
+			s.devices[path] = cloneDeviceObject(ifaces)
+		}
+	}
+	return s
+}
+
+// cloneDeviceObject copies the interfaces a device is read from, so
+// applying changes doesn't write to maps the caller still holds.
+func cloneDeviceObject(ifaces map[string]map[string]dbus.Variant) map[string]map[string]dbus.Variant {
+	obj := map[string]map[string]dbus.Variant{}
+	for _, iface := range []string{bluezDeviceIface, bluezBatteryIface} {
+		if props, ok := ifaces[iface]; ok {
+			obj[iface] = maps.Clone(props)
+		}
+	}
+	return obj
+}
+
+func (s *eventStream) event(ctx context.Context, sig *dbus.Signal) (Event, bool) {
+	switch sig.Name {
+	case dbusObjectManagerIface + ".InterfacesAdded":
+		return s.interfacesAdded(ctx, sig)
+	case dbusObjectManagerIface + ".InterfacesRemoved":
+		return s.interfacesRemoved(ctx, sig)
+	case dbusPropertiesIface + ".PropertiesChanged":
+		return s.propertiesChanged(ctx, sig)
+	}
+	return Event{}, false
+}
+
+func (s *eventStream) interfacesAdded(ctx context.Context, sig *dbus.Signal) (Event, bool) {
+	var path dbus.ObjectPath
+	var ifaces map[string]map[string]dbus.Variant
+	if dbus.Store(sig.Body, &path, &ifaces) != nil || !isAdapterChild(s.adapter, path) {
+		return Event{}, false
+	}
+	if _, ok := ifaces[bluezDeviceIface]; ok {
+		s.devices[path] = cloneDeviceObject(ifaces)
+		return Event{Kind: EventDeviceAdded, Device: deviceFromObject(s.devices[path])}, true
+	}
+	props, ok := ifaces[bluezBatteryIface]
+	if !ok {
+		return Event{}, false
+	}
+	obj, ok := s.object(ctx, path)
+	if !ok {
+		return Event{}, false
+	}
+	obj[bluezBatteryIface] = maps.Clone(props)
+	return Event{Kind: EventDeviceChanged, Device: deviceFromObject(obj)}, true
+}
+
+func (s *eventStream) interfacesRemoved(ctx context.Context, sig *dbus.Signal) (Event, bool) {
+	var path dbus.ObjectPath
+	var ifaces []string
+	if dbus.Store(sig.Body, &path, &ifaces) != nil || !isAdapterChild(s.adapter, path) {
+		return Event{}, false
+	}
+	if slices.Contains(ifaces, bluezDeviceIface) {
+		delete(s.devices, path)
+		return Event{Kind: EventDeviceRemoved, Device: BluetoothDevice{MAC: macFromDevicePath(path)}}, true
+	}
+	if !slices.Contains(ifaces, bluezBatteryIface) {
+		return Event{}, false
+	}
+	obj, ok := s.object(ctx, path)
+	if !ok {
+		return Event{}, false
+	}
+	delete(obj, bluezBatteryIface)
+	return Event{Kind: EventDeviceChanged, Device: deviceFromObject(obj)}, true
+}
+
+func (s *eventStream) propertiesChanged(ctx context.Context, sig *dbus.Signal) (Event, bool) {
+	var iface string
+	var changed map[string]dbus.Variant
+	var invalidated []string
+	if dbus.Store(sig.Body, &iface, &changed, &invalidated) != nil {
+		return Event{}, false
+	}
+	if iface == bluezAdapterIface && sig.Path == s.adapter {
+		v, ok := changed["Powered"]
+		return Event{Kind: EventPowerChanged, Powered: variantBool(v)}, ok
+	}
+	if (iface != bluezDeviceIface && iface != bluezBatteryIface) || !isAdapterChild(s.adapter, sig.Path) {
+		return Event{}, false
+	}
+	obj, ok := s.object(ctx, sig.Path)
+	if !ok {
+		return Event{}, false
+	}
+	props := obj[iface]
+	if props == nil {
+		props = map[string]dbus.Variant{}
+		obj[iface] = props
+	}
+	maps.Copy(props, changed)
+	for _, name := range invalidated {
+		delete(props, name)
+	}
+	return Event{Kind: EventDeviceChanged, Device: deviceFromObject(obj)}, true
+}
+
+// object returns the device's cached interfaces, reading them from BlueZ
+// the first time a device the stream hasn't seen changes.
+func (s *eventStream) object(ctx context.Context, path dbus.ObjectPath) (map[string]map[string]dbus.Variant, bool) {
+	if obj, ok := s.devices[path]; ok {
+		return obj, true
+	}
+	ifaces, err := readObject(ctx, s.b.conn.Object(bluezService, path))
+	if err != nil {
+		return nil, false
+	}
+	s.devices[path] = cloneDeviceObject(ifaces)
+	return s.devices[path], true
+}
+
+func isAdapterChild(adapter, path dbus.ObjectPath) bool {
+	return strings.HasPrefix(string(path), string(adapter)+"/dev_")
+}
+
+// macFromDevicePath reverses devicePath.
+func macFromDevicePath(path dbus.ObjectPath) string {
+	s := string(path)
+	i := strings.LastIndex(s, "/dev_")
+	if i < 0 {
+		return ""
+	}
+	return strings.ReplaceAll(s[i+len("/dev_"):], "_", ":")
+}
+
+func setProperty(ctx context.Context, obj dbus.BusObject, iface, name string, value any) error {
+	return obj.CallWithContext(ctx, dbusPropertiesIface+".Set", 0, iface, name, dbus.MakeVariant(value)).Err
+}
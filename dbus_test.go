@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const testAdapterPath = dbus.ObjectPath("/org/bluez/hci0")
+
+// fakeBluez is an in-process stand-in for the org.bluez service. It serves
+// ObjectManager and Properties calls from objects and records every other
+// method call as "<path> <method>".
+type fakeBluez struct {
+	objects managedObjects
+	calls   []string
+	signals chan<- *dbus.Signal
+	// matches counts the signal match rules currently added.
+	matches int
+	// getAlls counts Properties.GetAll calls.
+	getAlls int
+}
+
+func newFakeBluez() *fakeBluez {
+	return &fakeBluez{objects: managedObjects{
+		testAdapterPath: {
+			bluezAdapterIface: {
+				"Address": dbus.MakeVariant("00:1A:7D:DA:71:13"),
+				"Powered": dbus.MakeVariant(true),
+			},
+		},
+		devicePath(testAdapterPath, testMACHeadphones): {
+			bluezDeviceIface: {
+				"Address":   dbus.MakeVariant(testMACHeadphones),
+				"Name":      dbus.MakeVariant("Headphones"),
+				"Adapter":   dbus.MakeVariant(testAdapterPath),
+				"Connected": dbus.MakeVariant(true),
+				"Paired":    dbus.MakeVariant(true),
+				"Trusted":   dbus.MakeVariant(true),
+			},
+			bluezBatteryIface: {
+				"Percentage": dbus.MakeVariant(byte(75)),
+			},
+		},
+		devicePath(testAdapterPath, testMACMouse): {
+			bluezDeviceIface: {
+				"Address": dbus.MakeVariant(testMACMouse),
+				"Name":    dbus.MakeVariant("Mouse"),
+				"Adapter": dbus.MakeVariant(testAdapterPath),
+				"Paired":  dbus.MakeVariant(true),
+				"RSSI":    dbus.MakeVariant(int16(-60)),
+			},
+		},
+	}}
+}
+
+func (f *fakeBluez) Object(_ string, path dbus.ObjectPath) dbus.BusObject {
+	return &fakeObject{bus: f, path: path}
+}
+
+func (f *fakeBluez) AddMatchSignalContext(context.Context, ...dbus.MatchOption) error {
+	f.matches++
+	return nil
+}
+
+func (f *fakeBluez) RemoveMatchSignalContext(context.Context, ...dbus.MatchOption) error {
+	f.matches--
+	return nil
+}
+
+func (f *fakeBluez) Signal(ch chan<- *dbus.Signal)                     { f.signals = ch }
+func (f *fakeBluez) RemoveSignal(chan<- *dbus.Signal)                  { f.signals = nil }
+func (f *fakeBluez) Export(interface{}, dbus.ObjectPath, string) error { return nil }
+
+type fakeObject struct {
+	bus  *fakeBluez
+	path dbus.ObjectPath
+}
+
+func (o *fakeObject) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	return o.CallWithContext(context.Background(), method, flags, args...)
+}
+
+func (o *fakeObject) CallWithContext(_ context.Context, method string, _ dbus.Flags, args ...interface{}) *dbus.Call {
+	if method == dbusObjectManagerIface+".GetManagedObjects" {
+		return &dbus.Call{Body: []interface{}{o.bus.objects}}
+	}
+	ifaces, ok := o.bus.objects[o.path]
+	if !ok {
+		return &dbus.Call{Err: errors.New("unknown object " + string(o.path))}
+	}
+	switch method {
+	case dbusPropertiesIface + ".GetAll":
+		o.bus.getAlls++
+		props, ok := ifaces[args[0].(string)]
+		if !ok {
+			return &dbus.Call{Err: errors.New("unknown interface " + args[0].(string))}
+		}
+		return &dbus.Call{Body: []interface{}{props}}
+	case dbusPropertiesIface + ".Get":
+		return &dbus.Call{Body: []interface{}{ifaces[args[0].(string)][args[1].(string)]}}
+	case dbusPropertiesIface + ".Set":
+		ifaces[args[0].(string)][args[1].(string)] = args[2].(dbus.Variant)
+		return &dbus.Call{}
+	}
+	call := string(o.path) + " " + method
+	if uuid, ok := firstArg(args).(string); ok {
+		call += " " + uuid
+	}
+	o.bus.calls = append(o.bus.calls, call)
+	return &dbus.Call{}
+}
+
+func firstArg(args []interface{}) interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+	return args[0]
+}
+
+func (o *fakeObject) Go(method string, flags dbus.Flags, _ chan *dbus.Call, args ...interface{}) *dbus.Call {
+	return o.Call(method, flags, args...)
+}
+
+func (o *fakeObject) GoWithContext(ctx context.Context, method string, flags dbus.Flags, _ chan *dbus.Call, args ...interface{}) *dbus.Call {
+	return o.CallWithContext(ctx, method, flags, args...)
+}
+
+func (o *fakeObject) AddMatchSignal(string, string, ...dbus.MatchOption) *dbus.Call {
+	return &dbus.Call{}
+}
+
+func (o *fakeObject) RemoveMatchSignal(string, string, ...dbus.MatchOption) *dbus.Call {
+	return &dbus.Call{}
+}
+
+func (o *fakeObject) GetProperty(string) (dbus.Variant, error) {
+	return dbus.Variant{}, errors.New("not implemented")
+}
+
+func (o *fakeObject) StoreProperty(string, interface{}) error { return errors.New("not implemented") }
+func (o *fakeObject) SetProperty(string, interface{}) error   { return errors.New("not implemented") }
+func (o *fakeObject) Destination() string                     { return bluezService }
+func (o *fakeObject) Path() dbus.ObjectPath                   { return o.path }
+
+func TestDBusListDevices(t *testing.T) {
+	b := &dbusBackend{conn: newFakeBluez()}
+	devs, err := b.ListDevices(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BluetoothDevice{
+		{MAC: testMACMouse, Name: "Mouse", Paired: true, RSSI: -60, HasRSSI: true},
+		{MAC: testMACHeadphones, Name: "Headphones", Connected: true, Paired: true, Trusted: true, Battery: 75, HasBattery: true},
+	}
+	if len(devs) != len(want) {
+		t.Fatalf("got %d devices, want %d: %+v", len(devs), len(want), devs)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(devs[i], want[i]) {
+			t.Errorf("device %d: got %+v, want %+v", i, devs[i], want[i])
+		}
+	}
+}
+
+func TestDBusDeviceOperations(t *testing.T) {
+	bus := newFakeBluez()
+	b := &dbusBackend{conn: bus}
+	ctx := context.Background()
+
+	if err := b.Connect(ctx, testMACMouse); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Trust(ctx, testMACMouse); err != nil {
+		t.Fatal(err)
+	}
+	d, err := b.DeviceInfo(ctx, testMACMouse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Trusted {
+		t.Error("Trusted = false after Trust, want true")
+	}
+	if err := b.SetAlias(ctx, testMACMouse, "Work mouse"); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := b.DeviceInfo(ctx, testMACMouse); d.Alias != "Work mouse" || !d.HasAlias() {
+		t.Errorf("Alias = %q after SetAlias, want %q", d.Alias, "Work mouse")
+	}
+
+	wantCall := string(devicePath(testAdapterPath, testMACMouse)) + " " + bluezDeviceIface + ".Connect"
+	if len(bus.calls) != 1 || bus.calls[0] != wantCall {
+		t.Errorf("calls = %v, want [%s]", bus.calls, wantCall)
+	}
+
+	if err := b.Connect(ctx, "not-a-mac"); err == nil {
+		t.Error("expected error for invalid MAC, got nil")
+	}
+	if err := b.Connect(ctx, "00:00:00:00:00:01"); err == nil {
+		t.Error("expected error for unknown device, got nil")
+	}
+}
+
+func TestDBusPower(t *testing.T) {
+	b := &dbusBackend{conn: newFakeBluez()}
+	ctx := context.Background()
+
+	if err := b.Power(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	on, err := b.Powered(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if on {
+		t.Error("Powered = true after Power(false), want false")
+	}
+}
+
+func TestDBusEvents(t *testing.T) {
+	bus := newFakeBluez()
+	b := &dbusBackend{conn: bus}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := b.Events(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mousePath := devicePath(testAdapterPath, testMACMouse)
+	bus.objects[mousePath][bluezDeviceIface]["Connected"] = dbus.MakeVariant(true)
+	bus.signals <- &dbus.Signal{
+		Path: mousePath,
+		Name: dbusPropertiesIface + ".PropertiesChanged",
+		Body: []interface{}{bluezDeviceIface, map[string]dbus.Variant{"Connected": dbus.MakeVariant(true)}, []string{}},
+	}
+	ev := <-events
+	if ev.Kind != EventDeviceChanged || ev.Device.MAC != testMACMouse || !ev.Device.Connected || ev.Device.Name != "Mouse" {
+		t.Errorf("changed event = %+v, want connected mouse", ev)
+	}
+
+	bus.signals <- &dbus.Signal{
+		Path: "/",
+		Name: dbusObjectManagerIface + ".InterfacesRemoved",
+		Body: []interface{}{devicePath(testAdapterPath, testMACHeadphones), []string{bluezDeviceIface}},
+	}
+	ev = <-events
+	if ev.Kind != EventDeviceRemoved || ev.Device.MAC != testMACHeadphones {
+		t.Errorf("removed event = %+v, want headphones removed", ev)
+	}
+
+	headphonesPath := devicePath(testAdapterPath, testMACHeadphones)
+	bus.objects[headphonesPath][bluezBatteryIface]["Percentage"] = dbus.MakeVariant(byte(15))
+	bus.signals <- &dbus.Signal{
+		Path: headphonesPath,
+		Name: dbusPropertiesIface + ".PropertiesChanged",
+		Body: []interface{}{bluezBatteryIface, map[string]dbus.Variant{"Percentage": dbus.MakeVariant(byte(15))}, []string{}},
+	}
+	ev = <-events
+	if ev.Kind != EventDeviceChanged || !ev.Device.HasBattery || ev.Device.Battery != 15 {
+		t.Errorf("battery event = %+v, want headphones at 15%%", ev)
+	}
+
+	bus.signals <- &dbus.Signal{
+		Path: testAdapterPath,
+		Name: dbusPropertiesIface + ".PropertiesChanged",
+		Body: []interface{}{bluezAdapterIface, map[string]dbus.Variant{"Powered": dbus.MakeVariant(false)}, []string{}},
+	}
+	ev = <-events
+	if ev.Kind != EventPowerChanged || ev.Powered {
+		t.Errorf("power event = %+v, want powered off", ev)
+	}
+
+	// An advertisement is applied to the known device, and an invalidated
+	// property drops out of it.
+	bus.getAlls = 0
+	bus.signals <- &dbus.Signal{
+		Path: mousePath,
+		Name: dbusPropertiesIface + ".PropertiesChanged",
+		Body: []interface{}{bluezDeviceIface, map[string]dbus.Variant{"RSSI": dbus.MakeVariant(int16(-72))}, []string{}},
+	}
+	if ev = <-events; ev.Device.RSSI != -72 || !ev.Device.Connected {
+		t.Errorf("rssi event = %+v, want the connected mouse at -72 dBm", ev)
+	}
+	bus.signals <- &dbus.Signal{
+		Path: mousePath,
+		Name: dbusPropertiesIface + ".PropertiesChanged",
+		Body: []interface{}{bluezDeviceIface, map[string]dbus.Variant{}, []string{"RSSI"}},
+	}
+	if ev = <-events; ev.Device.HasRSSI || ev.Device.Name != "Mouse" {
+		t.Errorf("invalidated event = %+v, want the mouse without a signal reading", ev)
+	}
+	if bus.getAlls != 0 {
+		t.Errorf("%d GetAll calls for devices the stream already knew", bus.getAlls)
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("events channel still open after cancel")
+	}
+	if bus.matches != 0 {
+		t.Errorf("%d match rules left on the bus", bus.matches)
+	}
+}
+
+func TestDBusEventsConnectionClosed(t *testing.T) {
+	bus := newFakeBluez()
+	b := &dbusBackend{conn: bus}
+	events, err := b.Events(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// godbus closes signal channels when the connection drops.
+	close(bus.signals)
+	if _, ok := <-events; ok {
+		t.Error("events channel still open after the connection closed")
+	}
+	if bus.matches != 0 {
+		t.Errorf("%d match rules left on the bus", bus.matches)
+	}
+}
+
+func TestDBusDiscover(t *testing.T) {
+	bus := newFakeBluez()
+	b := &dbusBackend{conn: bus}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	found, err := b.Discover(ctx, DiscoveryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const testMACSpeaker = "66:55:44:33:22:11"
+	bus.signals <- &dbus.Signal{
+		Path: "/",
+		Name: dbusObjectManagerIface + ".InterfacesAdded",
+		Body: []interface{}{devicePath(testAdapterPath, testMACSpeaker), map[string]map[string]dbus.Variant{
+			bluezDeviceIface: {
+				"Address": dbus.MakeVariant(testMACSpeaker),
+				"Name":    dbus.MakeVariant("Speaker"),
+				"RSSI":    dbus.MakeVariant(int16(-70)),
+			},
+		}},
+	}
+	if d := <-found; d.MAC != testMACSpeaker || d.RSSI != -70 {
+		t.Errorf("found %+v, want the speaker at -70 dBm", d)
+	}
+
+	cancel()
+	for range found {
+	}
+	want := []string{
+		string(testAdapterPath) + " " + bluezAdapterIface + ".SetDiscoveryFilter",
+		string(testAdapterPath) + " " + bluezAdapterIface + ".StartDiscovery",
+		string(testAdapterPath) + " " + bluezAdapterIface + ".StopDiscovery",
+	}
+	if !reflect.DeepEqual(bus.calls, want) {
+		t.Errorf("calls = %v, want %v", bus.calls, want)
+	}
+}
+
+func TestDiscoveryFilterArgs(t *testing.T) {
+	if args := discoveryFilterArgs(DiscoveryFilter{}); len(args) != 0 {
+		t.Errorf("empty filter = %v, want no keys", args)
+	}
+	off := false
+	args := discoveryFilterArgs(DiscoveryFilter{Transport: "le", MinRSSI: -70, UUIDs: []string{testUUIDA2DP}, DuplicateData: &off})
+	want := map[string]dbus.Variant{
+		"Transport":     dbus.MakeVariant("le"),
+		"RSSI":          dbus.MakeVariant(int16(-70)),
+		"UUIDs":         dbus.MakeVariant([]string{testUUIDA2DP}),
+		"DuplicateData": dbus.MakeVariant(false),
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestDBusProfiles(t *testing.T) {
+	bus := newFakeBluez()
+	b := &dbusBackend{conn: bus}
+	ctx := context.Background()
+	if err := b.ConnectProfile(ctx, testMACHeadphones, testUUIDA2DP); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DisconnectProfile(ctx, testMACHeadphones, testUUIDHFP); err != nil {
+		t.Fatal(err)
+	}
+	path := string(devicePath(testAdapterPath, testMACHeadphones))
+	want := []string{
+		path + " " + bluezDeviceIface + ".ConnectProfile " + testUUIDA2DP,
+		path + " " + bluezDeviceIface + ".DisconnectProfile " + testUUIDHFP,
+	}
+	if !reflect.DeepEqual(bus.calls, want) {
+		t.Errorf("calls = %v, want %v", bus.calls, want)
+	}
+}
+
+func TestDBusAdapterSettings(t *testing.T) {
+	bus := newFakeBluez()
+	b := &dbusBackend{conn: bus}
+	ctx := context.Background()
+	on, alias, timeout := true, "desk", 3*time.Minute
+	err := b.ConfigureAdapter(ctx, AdapterSettings{Alias: &alias, Discoverable: &on, DiscoverableTimeout: &timeout, PairableTimeout: &timeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.AdapterInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Adapter{
+		MAC:                 "00:1A:7D:DA:71:13",
+		Name:                "desk",
+		Powered:             true,
+		Discoverable:        true,
+		DiscoverableTimeout: timeout,
+		PairableTimeout:     timeout,
+		Default:             true,
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if v := bus.objects[testAdapterPath][bluezAdapterIface]["DiscoverableTimeout"].Value(); v != uint32(180) {
+		t.Errorf("DiscoverableTimeout = %#v, want uint32(180)", v)
+	}
+}
+
+func TestDBusAdapters(t *testing.T) {
+	bus := newFakeBluez()
+	const donglePath = dbus.ObjectPath("/org/bluez/hci1")
+	bus.objects[donglePath] = map[string]map[string]dbus.Variant{
+		bluezAdapterIface: {
+			"Address": dbus.MakeVariant("5C:F3:70:8B:12:34"),
+			"Alias":   dbus.MakeVariant("dongle"),
+			"Powered": dbus.MakeVariant(false),
+		},
+	}
+	const testMACKeyboard = "22:33:44:55:66:77"
+	bus.objects[devicePath(donglePath, testMACKeyboard)] = map[string]map[string]dbus.Variant{
+		bluezDeviceIface: {
+			"Address": dbus.MakeVariant(testMACKeyboard),
+			"Adapter": dbus.MakeVariant(donglePath),
+		},
+	}
+	b := &dbusBackend{conn: bus}
+	ctx := context.Background()
+
+	adapters, err := b.Adapters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(adapters) != 2 || !adapters[0].Default || adapters[1].MAC != "5C:F3:70:8B:12:34" || adapters[1].Default {
+		t.Fatalf("unexpected adapters %+v", adapters)
+	}
+
+	dongle := b.WithAdapter("5c:f3:70:8b:12:34")
+	if err := dongle.Connect(ctx, testMACKeyboard); err != nil {
+		t.Fatal(err)
+	}
+	want := string(devicePath(donglePath, testMACKeyboard)) + " " + bluezDeviceIface + ".Connect"
+	if len(bus.calls) != 1 || bus.calls[0] != want {
+		t.Errorf("calls = %v, want [%s]", bus.calls, want)
+	}
+	if devs, err := dongle.ListDevices(ctx); err != nil || len(devs) != 1 || devs[0].MAC != testMACKeyboard {
+		t.Errorf("dongle devices = %+v, %v; want only the keyboard", devs, err)
+	}
+	if _, err := b.WithAdapter("00:00:00:00:00:09").Powered(ctx); err == nil {
+		t.Error("expected error for unknown adapter")
+	}
+}
+
+func TestDBusRemove(t *testing.T) {
+	bus := newFakeBluez()
+	b := &dbusBackend{conn: bus}
+	if err := b.Remove(context.Background(), testMACMouse); err != nil {
+		t.Fatal(err)
+	}
+	want := string(testAdapterPath) + " " + bluezAdapterIface + ".RemoveDevice"
+	if len(bus.calls) != 1 || bus.calls[0] != want {
+		t.Errorf("calls = %v, want [%s]", bus.calls, want)
+	}
+}
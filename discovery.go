@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DiscoveryFilter narrows what discovery reports. BlueZ applies everything
+// but Name; the zero value reports every device.
+type DiscoveryFilter struct {
+	// Transport is "auto", "bredr" (classic) or "le"; "" means auto.
+	Transport string
+	// MinRSSI hides devices weaker than this many dBm; 0 means no limit.
+	MinRSSI int
+	// Pathloss hides devices whose path loss exceeds this many dB; 0
+	// means no limit. BlueZ accepts it or MinRSSI, not both.
+	Pathloss int
+	// UUIDs limits discovery to devices advertising one of these services.
+	UUIDs []string
+	// DuplicateData, when set, controls whether repeated advertisements
+	// are reported; BlueZ reports them by default.
+	DuplicateData *bool
+	// Name is matched case-insensitively against the device name and
+	// alias, here rather than by BlueZ.
+	Name *regexp.Regexp
+}
+
+// discoveryFilterKeys are the names a filter is written with.
+var discoveryFilterKeys = []string{"transport", "rssi", "pathloss", "uuids", "duplicate-data", "name"}
+
+func (f DiscoveryFilter) empty() bool {
+	return f.String() == ""
+}
+
+// parseDiscoveryFilter reads key=value pairs such as "transport=le" or
+// "rssi=-70", the form String writes.
+func parseDiscoveryFilter(args []string) (DiscoveryFilter, error) {
+	var f DiscoveryFilter
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return f, fmt.Errorf("expected key=value, got %q", arg)
+		}
+		if err := f.set(strings.ToLower(key), value); err != nil {
+			return f, err
+		}
+	}
+	if f.MinRSSI != 0 && f.Pathloss != 0 {
+		return f, errors.New("rssi and pathloss cannot be combined")
+	}
+	return f, nil
+}
+
+// parseDiscoveryFilterLine reads a filter typed on one line, as in the
+// TUI's filter editor. name= takes the rest of the line, so a pattern such
+// as "name=Sony WH" may contain spaces; String writes it last for that
+// reason.
+func parseDiscoveryFilterLine(line string) (DiscoveryFilter, error) {
+	var args []string
+	for rest := strings.TrimSpace(line); rest != ""; {
+		if strings.HasPrefix(strings.ToLower(rest), "name=") {
+			args = append(args, rest)
+			break
+		}
+		field, tail := rest, ""
+		if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+			field, tail = rest[:i], rest[i:]
+		}
+		args = append(args, field)
+		rest = strings.TrimLeftFunc(tail, unicode.IsSpace)
+	}
+	return parseDiscoveryFilter(args)
+}
+
+func (f *DiscoveryFilter) set(key, value string) error {
+	set, ok := discoveryFilterSetters[key]
+	if !ok {
+		return fmt.Errorf("unknown filter %q; use one of %s", key, strings.Join(discoveryFilterKeys, ", "))
+	}
+	return set(f, value)
+}
+
+// discoveryFilterSetters parse each filter key's value into the filter.
+var discoveryFilterSetters = map[string]func(f *DiscoveryFilter, value string) error{
+	"transport":      (*DiscoveryFilter).setTransport,
+	"rssi":           (*DiscoveryFilter).setMinRSSI,
+	"pathloss":       (*DiscoveryFilter).setPathloss,
+	"uuids":          (*DiscoveryFilter).setUUIDs,
+	"uuid":           (*DiscoveryFilter).setUUIDs,
+	"duplicate-data": (*DiscoveryFilter).setDuplicateData,
+	"name":           (*DiscoveryFilter).setName,
+}
+
+func (f *DiscoveryFilter) setTransport(value string) error {
+	switch v := strings.ToLower(value); v {
+	case "auto", "bredr", "le":
+		f.Transport = v
+		return nil
+	}
+	return fmt.Errorf("invalid transport %q; use auto, bredr or le", value)
+}
+
+func (f *DiscoveryFilter) setMinRSSI(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < -127 || n > 20 || n == 0 {
+		return fmt.Errorf("invalid rssi %q; use a dBm value such as -70", value)
+	}
+	f.MinRSSI = n
+	return nil
+}
+
+func (f *DiscoveryFilter) setPathloss(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 || n > 137 {
+		return fmt.Errorf("invalid pathloss %q; use 1 to 137 dB", value)
+	}
+	f.Pathloss = n
+	return nil
+}
+
+func (f *DiscoveryFilter) setUUIDs(value string) error {
+	f.UUIDs = nil
+	for _, q := range strings.Split(value, ",") {
+		uuid, err := resolveProfile(strings.TrimSpace(q))
+		if err != nil {
+			return err
+		}
+		f.UUIDs = append(f.UUIDs, uuid)
+	}
+	return nil
+}
+
+func (f *DiscoveryFilter) setDuplicateData(value string) error {
+	on, err := parseOnOff(value)
+	if err != nil {
+		return fmt.Errorf("invalid duplicate-data: %w", err)
+	}
+	f.DuplicateData = &on
+	return nil
+}
+
+func (f *DiscoveryFilter) setName(value string) error {
+	re, err := regexp.Compile("(?i)" + value)
+	if err != nil {
+		return fmt.Errorf("invalid name pattern: %w", err)
+	}
+	f.Name = re
+	return nil
+}
+
+// String writes the filter back as space-separated key=value pairs.
+func (f DiscoveryFilter) String() string {
+	var parts []string
+	if f.Transport != "" {
+		parts = append(parts, "transport="+f.Transport)
+	}
+	if f.MinRSSI != 0 {
+		parts = append(parts, "rssi="+strconv.Itoa(f.MinRSSI))
+	}
+	if f.Pathloss != 0 {
+		parts = append(parts, "pathloss="+strconv.Itoa(f.Pathloss))
+	}
+	if len(f.UUIDs) > 0 {
+		names := make([]string, 0, len(f.UUIDs))
+		for _, uuid := range f.UUIDs {
+			name := uuid
+			if p := lookupProfile(uuid); p.Short != "" {
+				name = strings.ToLower(p.Short)
+			}
+			names = append(names, name)
+		}
+		parts = append(parts, "uuids="+strings.Join(names, ","))
+	}
+	if f.DuplicateData != nil {
+		parts = append(parts, "duplicate-data="+onOff(*f.DuplicateData))
+	}
+	// name= comes last: parseDiscoveryFilterLine gives it the rest of the
+	// line.
+	if f.Name != nil {
+		parts = append(parts, "name="+strings.TrimPrefix(f.Name.String(), "(?i)"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Matches applies the client-side part of the filter. The RSSI limit is
+// checked again because BlueZ also reports devices it already knew about.
+func (f DiscoveryFilter) Matches(d BluetoothDevice) bool {
+	if f.MinRSSI != 0 && d.HasRSSI && d.RSSI < f.MinRSSI {
+		return false
+	}
+	if f.Name != nil && !f.Name.MatchString(d.Name) && !f.Name.MatchString(d.Alias) {
+		return false
+	}
+	return true
+}
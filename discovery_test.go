@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+
+func TestParseDiscoveryFilter(t *testing.T) {
+	f, err := parseDiscoveryFilter([]string{"Transport=LE", "rssi=-70", "uuids=a2dp,0000180f-0000-1000-8000-00805f9b34fb", "duplicate-data=off", "name=^jbl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Transport != "le" || f.MinRSSI != -70 || len(f.UUIDs) != 2 || f.UUIDs[0] != testUUIDA2DP || f.DuplicateData == nil || *f.DuplicateData {
+		t.Errorf("unexpected filter %+v", f)
+	}
+	want := "transport=le rssi=-70 uuids=a2dp,bas duplicate-data=off name=^jbl"
+	if got := f.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if _, err := parseDiscoveryFilter([]string{"transport=le", "rssi=-70"}); err != nil {
+		t.Errorf("round trip: %v", err)
+	}
+	if f, err := parseDiscoveryFilter(nil); err != nil || !f.empty() {
+		t.Errorf("empty filter = %+v, %v", f, err)
+	}
+
+	for _, args := range [][]string{
+		{"transport"},
+		{"transport=usb"},
+		{"rssi=strong"},
+		{"rssi=0"},
+		{"pathloss=-3"},
+		{"rssi=-70", "pathloss=80"},
+		{"uuids=music"},
+		{"duplicate-data=maybe"},
+		{"name=("},
+		{"colour=blue"},
+	} {
+		if _, err := parseDiscoveryFilter(args); err == nil {
+			t.Errorf("%q: expected error", args)
+		}
+	}
+}
+
+func TestDiscoveryFilterLineRoundTrip(t *testing.T) {
+	for _, line := range []string{
+		"name=Sony WH",
+		"transport=le rssi=-70 name=^Sony WH-1000XM[45]$",
+		"uuids=a2dp duplicate-data=on name=  two  spaces",
+		"pathloss=80",
+	} {
+		f, err := parseDiscoveryFilterLine(line)
+		if err != nil {
+			t.Errorf("%q: %v", line, err)
+			continue
+		}
+		again, err := parseDiscoveryFilterLine(f.String())
+		if err != nil {
+			t.Errorf("%q: reparsing %q: %v", line, f.String(), err)
+			continue
+		}
+		if again.String() != f.String() {
+			t.Errorf("%q: round trip gave %q, want %q", line, again.String(), f.String())
+		}
+	}
+
+	f, err := parseDiscoveryFilterLine("  rssi=-70   name=Sony WH  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Matches(BluetoothDevice{Name: "SONY WH-1000XM4"}) || f.Matches(BluetoothDevice{Name: "Sony"}) {
+		t.Errorf("name=Sony WH matched the wrong devices: %v", f.Name)
+	}
+	if _, err := parseDiscoveryFilterLine("rssi=-70 transport"); err == nil {
+		t.Error("expected an error for a word without a value")
+	}
+}
+
+func TestDiscoveryFilterMatches(t *testing.T) {
+	f, err := parseDiscoveryFilter([]string{"name=^jbl", "rssi=-70"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		device BluetoothDevice
+		want   bool
+	}{
+		{"name and signal", BluetoothDevice{Name: "JBL Flip 5", RSSI: -60, HasRSSI: true}, true},
+		{"alias matches", BluetoothDevice{Name: "Flip", Alias: "jbl kitchen"}, true},
+		{"no reading yet", BluetoothDevice{Name: "JBL Go"}, true},
+		{"too weak", BluetoothDevice{Name: "JBL Flip 5", RSSI: -80, HasRSSI: true}, false},
+		{"wrong name", BluetoothDevice{Name: "Beacon", RSSI: -40, HasRSSI: true}, false},
+	}
+	for _, tc := range tests {
+		if got := f.Matches(tc.device); got != tc.want {
+			t.Errorf("%s: Matches = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// glyphSet is every symbol the TUI draws beyond plain text, so ASCII mode
+// can swap them all at once. Empty decorations are left out.
+type glyphSet struct {
+	connected, paired, unpaired, blocked string
+	bluetoothOn, bluetoothOff, scanning  string
+	warning                              string
+	// batteryFull and batteryEmpty fill the battery gauge's cells.
+	batteryFull, batteryEmpty string
+	// signal holds the four signal bars, weakest first.
+	signal                string
+	scrollUp, scrollDown  string
+	left, right, up, down string
+	// ellipsis ends a truncated name.
+	ellipsis string
+	border   lipgloss.Border
+}
+
+var unicodeGlyphs = glyphSet{
+	connected:    "●",
+	paired:       "◐",
+	unpaired:     "○",
+	blocked:      "⊘",
+	bluetoothOn:  "🔵",
+	bluetoothOff: "🔴",
+	scanning:     "🔍",
+	warning:      "⚠",
+	batteryFull:  "▰",
+	batteryEmpty: "▱",
+	signal:       "▂▄▆█",
+	scrollUp:     "↑",
+	scrollDown:   "↓",
+	left:         "←",
+	right:        "→",
+	up:           "↑",
+	down:         "↓",
+	ellipsis:     "…",
+	border:       lipgloss.RoundedBorder(),
+}
+
+var asciiGlyphs = glyphSet{
+	connected:    "*",
+	paired:       "+",
+	unpaired:     "-",
+	blocked:      "x",
+	warning:      "!",
+	batteryFull:  "#",
+	batteryEmpty: "-",
+	signal:       "||||",
+	scrollUp:     "^",
+	scrollDown:   "v",
+	left:         "Left",
+	right:        "Right",
+	up:           "Up",
+	down:         "Down",
+	ellipsis:     "~",
+	border:       lipgloss.ASCIIBorder(),
+}
+
+func glyphsFor(ascii bool) glyphSet {
+	if ascii {
+		return asciiGlyphs
+	}
+	return unicodeGlyphs
+}
+
+// decorate puts glyph in front of s, if there is one.
+func decorate(glyph, s string) string {
+	if glyph == "" {
+		return s
+	}
+	return glyph + " " + s
+}
+
+// truncateWidth cuts s to at most width terminal cells, ending it with
+// tail when anything was cut. Wide characters count double.
+func truncateWidth(s string, width int, tail string) string {
+	if ansi.StringWidth(s) <= width {
+		return s
+	}
+	if width <= ansi.StringWidth(tail) {
+		return ansi.Truncate(s, max(width, 0), "")
+	}
+	return ansi.Truncate(s, width, tail)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Keys the dialogs and prompts handle themselves, spelled as Bubble Tea
+// names them.
+const (
+	keyEnter     = "enter"
+	keyEsc       = "esc"
+	keyBackspace = "backspace"
+	keyCtrlC     = "ctrl+c"
+)
+
+// action is something the device list does when its key is pressed.
+type action string
+
+const (
+	actQuit            action = "quit"
+	actUp              action = "up"
+	actDown            action = "down"
+	actPageUp          action = "page-up"
+	actPageDown        action = "page-down"
+	actTop             action = "top"
+	actBottom          action = "bottom"
+	actConnect         action = "connect"
+	actSearch          action = "search"
+	actClearSearch     action = "clear-search"
+	actScan            action = "scan"
+	actRefresh         action = "refresh"
+	actFullRefresh     action = "full-refresh"
+	actSort            action = "sort"
+	actGroup           action = "group"
+	actDisconnect      action = "disconnect"
+	actPair            action = "pair"
+	actTrust           action = "trust"
+	actBlock           action = "block"
+	actRemove          action = "remove"
+	actRename          action = "rename"
+	actProfiles        action = "profiles"
+	actDetails         action = "details"
+	actSwitchAdapter   action = "switch-adapter"
+	actAdapterSettings action = "adapter-settings"
+	actFilter          action = "filter"
+	actPower           action = "power"
+)
+
+// binding ties an action to its keys. Each key is a space-separated
+// sequence of key names as Bubble Tea spells them, so "g g" is a chord.
+type binding struct {
+	action action
+	keys   []string
+	// help labels the binding on screen; empty leaves it out.
+	help string
+}
+
+// keymap is the device list's bindings, in the order help lists them.
+type keymap []binding
+
+var defaultKeymap = keymap{
+	{actUp, []string{"up", "k"}, "Up"},
+	{actDown, []string{"down", "j"}, "Down"},
+	{actPageUp, []string{"pgup"}, ""},
+	{actPageDown, []string{"pgdown"}, ""},
+	{actTop, []string{"home", "g"}, ""},
+	{actBottom, []string{"end", "G"}, ""},
+	{actSearch, []string{"/"}, "Search"},
+	{actClearSearch, []string{keyEsc}, ""},
+	{actConnect, []string{keyEnter, "space"}, "Connect/Disconnect"},
+	{actScan, []string{"s"}, "Scan/Stop"},
+	{actPair, []string{"p"}, "Pair"},
+	{actDisconnect, []string{"d"}, "Disconnect"},
+	{actTrust, []string{"t"}, "Trust/Untrust"},
+	{actBlock, []string{"b"}, "Block/Unblock"},
+	{actRemove, []string{"x"}, "Remove"},
+	{actRename, []string{"n"}, "Rename"},
+	{actProfiles, []string{"u"}, "Profiles"},
+	{actDetails, []string{"i"}, "Details"},
+	{actSort, []string{"o"}, "Sort"},
+	{actGroup, []string{"H"}, "Group"},
+	{actSwitchAdapter, []string{"a"}, "Switch adapter"},
+	{actPower, []string{"e"}, "Enable/Disable Bluetooth"},
+	{actRefresh, []string{"r"}, "Refresh"},
+	{actFilter, []string{"f"}, "Scan filter"},
+	{actAdapterSettings, []string{"A"}, "Adapter settings"},
+	{actFullRefresh, []string{"ctrl+r"}, "Full Refresh"},
+	{actQuit, []string{"q"}, "Quit"},
+}
+
+// keyList is one key or a list of them in the config file.
+type keyList []string
+
+func (k *keyList) UnmarshalTOML(v any) error {
+	switch v := v.(type) {
+	case string:
+		*k = keyList{v}
+		return nil
+	case []any:
+		keys := make(keyList, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("expected key names, got %v", item)
+			}
+			keys = append(keys, s)
+		}
+		*k = keys
+		return nil
+	}
+	return fmt.Errorf("expected a key name or a list of them, got %v", v)
+}
+
+// newKeymap applies overrides, keyed by action name, to the defaults. An
+// override replaces all of an action's keys; an empty list unbinds it.
+// ctrl+c isn't in the keymap: it always quits, so it can't be rebound.
+func newKeymap(overrides map[string]keyList) (keymap, error) {
+	km := slices.Clone(defaultKeymap)
+	for name, keys := range overrides {
+		i := slices.IndexFunc(km, func(b binding) bool { return string(b.action) == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown key action %q; use one of %s", name, strings.Join(km.actions(), ", "))
+		}
+		seqs := make([]string, 0, len(keys))
+		for _, k := range keys {
+			seq := strings.Join(strings.Fields(k), " ")
+			if seq == "" {
+				return nil, fmt.Errorf("empty key for %s", name)
+			}
+			if slices.Contains(strings.Fields(seq), keyCtrlC) {
+				return nil, fmt.Errorf("ctrl+c always quits and can't be bound to %s", name)
+			}
+			seqs = append(seqs, seq)
+		}
+		km[i].keys = seqs
+	}
+	return km, km.check()
+}
+
+func (km keymap) actions() []string {
+	names := make([]string, len(km))
+	for i, b := range km {
+		names[i] = string(b.action)
+	}
+	return names
+}
+
+// check rejects a key bound twice, and a key that is the start of a chord,
+// which would fire before the chord could be finished.
+func (km keymap) check() error {
+	type bound struct {
+		seq    string
+		action action
+	}
+	var all []bound
+	for _, b := range km {
+		for _, seq := range b.keys {
+			for _, other := range all {
+				switch {
+				case other.seq == seq:
+					return fmt.Errorf("key %q is bound to both %s and %s", seq, other.action, b.action)
+				case strings.HasPrefix(seq, other.seq+" "):
+					return fmt.Errorf("key %q (%s) hides the chord %q (%s)", other.seq, other.action, seq, b.action)
+				case strings.HasPrefix(other.seq, seq+" "):
+					return fmt.Errorf("key %q (%s) hides the chord %q (%s)", seq, b.action, other.seq, other.action)
+				}
+			}
+			all = append(all, bound{seq, b.action})
+		}
+	}
+	return nil
+}
+
+// lookup finds the action bound to seq, or reports that seq starts a
+// chord.
+func (km keymap) lookup(seq string) (a action, found, prefix bool) {
+	for _, b := range km {
+		for _, k := range b.keys {
+			if k == seq {
+				return b.action, true, false
+			}
+			if strings.HasPrefix(k, seq+" ") {
+				prefix = true
+			}
+		}
+	}
+	return "", false, prefix
+}
+
+// has reports whether the single key k is bound to a. The dialogs use it
+// so their navigation follows the device list's bindings.
+func (km keymap) has(a action, k string) bool {
+	for _, b := range km {
+		if b.action == a && slices.Contains(b.keys, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyName is how msg is spelled in a binding. Bubble Tea calls the space
+// bar " ", which would split chords.
+func keyName(msg tea.KeyMsg) string {
+	if s := msg.String(); s != " " {
+		return s
+	}
+	return "space"
+}
+
+var keyDisplayNames = map[string]string{
+	keyEnter: "Enter",
+	"space":  "Space",
+	keyEsc:   "Esc",
+	"tab":    "Tab",
+	"pgup":   "PgUp",
+	"pgdown": "PgDn",
+	"home":   "Home",
+	"end":    "End",
+}
+
+// displayKey spells seq for the help, with arrows from g.
+func displayKey(seq string, g glyphSet) string {
+	arrows := map[string]string{"up": g.up, "down": g.down, "left": g.left, "right": g.right}
+	keys := strings.Fields(seq)
+	for i, k := range keys {
+		if name, ok := arrows[k]; ok {
+			keys[i] = name
+		} else if name, ok := keyDisplayNames[k]; ok {
+			keys[i] = name
+		} else if rest, ok := strings.CutPrefix(k, "ctrl+"); ok {
+			keys[i] = "Ctrl+" + rest
+		}
+	}
+	return strings.Join(keys, " ")
+}
+
+// key is the first key bound to a, for messages such as "Press 's' to
+// scan"; empty if a is unbound.
+func (km keymap) key(a action, g glyphSet) string {
+	for _, b := range km {
+		if b.action == a && len(b.keys) > 0 {
+			return displayKey(b.keys[0], g)
+		}
+	}
+	return ""
+}
+
+// helpEntries renders each labelled, bound action as "keys: label".
+// labels can replace a label, for ones that show state.
+func (km keymap) helpEntries(labels map[action]string, g glyphSet) []string {
+	var entries []string
+	for _, b := range km {
+		if b.help == "" || len(b.keys) == 0 {
+			continue
+		}
+		keys := make([]string, len(b.keys))
+		for i, k := range b.keys {
+			keys[i] = displayKey(k, g)
+		}
+		label := b.help
+		if l, ok := labels[b.action]; ok {
+			label = l
+		}
+		entries = append(entries, strings.Join(keys, "/")+": "+label)
+	}
+	return entries
+}
+
+// wrapEntries lays entries out two spaces apart in lines no wider than
+// width, each indented by two spaces.
+func wrapEntries(entries []string, width int) string {
+	var lines []string
+	line := ""
+	for _, e := range entries {
+		if line != "" && lipgloss.Width(line)+2+lipgloss.Width(e) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line == "" {
+			line = "  " + e
+		} else {
+			line += "  " + e
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
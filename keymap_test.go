@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewKeymap(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]keyList
+		wantErr   string
+	}{
+		{"defaults", nil, ""},
+		{"rebind", map[string]keyList{"scan": {"S", "ctrl+s"}}, ""},
+		{"unbind", map[string]keyList{"remove": {}}, ""},
+		{"chord", map[string]keyList{"top": {"home", "g  g"}}, ""},
+		{"unknown action", map[string]keyList{"explode": {"X"}}, "unknown key action"},
+		{"empty key", map[string]keyList{"scan": {" "}}, "empty key"},
+		{"duplicate", map[string]keyList{"scan": {"p"}}, `key "p" is bound to both`},
+		{"ctrl+c", map[string]keyList{"scan": {"space ctrl+c"}}, "ctrl+c always quits"},
+		{"key hides chord", map[string]keyList{"remove": {"d d"}}, `key "d" (disconnect) hides the chord "d d" (remove)`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			km, err := newKeymap(tc.overrides)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("newKeymap error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, keys := range tc.overrides {
+				for _, k := range keys {
+					seq := strings.Join(strings.Fields(k), " ")
+					if a, found, _ := km.lookup(seq); !found || string(a) != name {
+						t.Errorf("lookup(%q) = %q, %v; want %s", seq, a, found, name)
+					}
+				}
+			}
+		})
+	}
+	if defaultKeymap[0].keys[0] != "up" {
+		t.Error("newKeymap changed the defaults")
+	}
+}
+
+func TestHelpEntries(t *testing.T) {
+	km, err := newKeymap(map[string]keyList{"scan": {"ctrl+s", "space s"}, "connect": {"enter"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	help := wrapEntries(km.helpEntries(map[action]string{actSort: "Sort (name)"}, unicodeGlyphs), 40)
+	for _, want := range []string{"↑/k: Up", "Ctrl+s/Space s: Scan/Stop", "Enter: Connect/Disconnect", "o: Sort (name)"} {
+		if !strings.Contains(help, want) {
+			t.Errorf("help is missing %q:\n%s", want, help)
+		}
+	}
+	for _, line := range strings.Split(help, "\n") {
+		if len([]rune(line)) > 40 {
+			t.Errorf("line wider than 40 columns: %q", line)
+		}
+	}
+}
+
+func TestEveryActionHasAHandler(t *testing.T) {
+	for _, b := range defaultKeymap {
+		if _, ok := actionHandlers[b.action]; !ok {
+			t.Errorf("no handler for %s", b.action)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 )
 
 var (
@@ -25,24 +29,204 @@ func main() {
 		}
 	}
 
-	p := tea.NewProgram(initialModel(), tea.WithAltScreen(), tea.WithMouseCellMotion())
-	if _, err := p.Run(); err != nil {
+	cfg, args := parseFlags(os.Args[1:])
+	backend, adapterMAC := openBackend(cfg)
+	if len(args) > 0 {
+		os.Exit(runCLI(backend, cfg.Timeouts, args, os.Stdout, os.Stderr))
+	}
+
+	p := tea.NewProgram(newTUIModel(cfg, backend, adapterMAC), tea.WithAltScreen(), tea.WithMouseCellMotion())
+	final, err := p.Run()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error running program: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitFailure)
+	}
+	if fm, ok := final.(Model); ok && fm.statePath != "" {
+		if err := saveState(fm.statePath, fm.state()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
 	}
 }
 
+// parseFlags loads the config and applies the environment and flags over
+// it, returning the settings and the remaining arguments. It exits on bad
+// usage.
+func parseFlags(args []string) (Config, []string) {
+	fs := flag.NewFlagSet("hyprBluetooth", flag.ContinueOnError)
+	fs.Usage = printUsage
+	configPath := fs.String("config", "", "")
+	backendKind := fs.String("backend", "", "")
+	lowBattery := fs.Int("low-battery", 0, "")
+	adapter := fs.String("adapter", "", "")
+	scanLimit := fs.String("scan-duration", "", "")
+	theme := fs.String("theme", "", "")
+	ascii := fs.Bool("ascii", false, "")
+	if err := fs.Parse(args); err != nil {
+		os.Exit(exitUsage)
+	}
+
+	cfg, err := loadUserConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	// Flags win over the environment, which wins over the config file.
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["backend"] {
+		*backendKind = envOr("HYPRBLUETOOTH_BACKEND", cfg.Backend)
+	}
+	if !set["adapter"] {
+		*adapter = envOr("HYPRBLUETOOTH_ADAPTER", cfg.Adapter)
+	}
+	if !set["low-battery"] {
+		*lowBattery = cfg.LowBattery
+	}
+	if !set["scan-duration"] {
+		*scanLimit = os.Getenv("HYPRBLUETOOTH_SCAN_DURATION")
+	}
+	if set["ascii"] {
+		cfg.ASCII = ascii
+	}
+
+	if *lowBattery < 0 || *lowBattery > 100 {
+		fmt.Fprintf(os.Stderr, "Error: --low-battery must be between 0 and 100, got %d\n", *lowBattery)
+		os.Exit(exitUsage)
+	}
+	if *scanLimit != "" {
+		if cfg.ScanDuration, err = parseTimeout(*scanLimit); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --scan-duration: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+	if *theme != "" {
+		cfg.Theme = *theme
+	}
+	cfg.Backend, cfg.Adapter, cfg.LowBattery = *backendKind, *adapter, *lowBattery
+	return cfg, fs.Args()
+}
+
+// openBackend connects to the configured backend with the saved aliases
+// and selects the configured adapter, returning its address. It exits if
+// either fails.
+func openBackend(cfg Config) (Backend, string) {
+	backend, err := newBackend(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	if path, err := defaultAliasPath(); err == nil {
+		// A broken alias file only costs the local names.
+		aliases, err := loadAliases(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		backend = withAliases(backend, aliases)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Command)
+	defer cancel()
+	backend, adapterMAC, err := selectAdapter(ctx, backend, cfg.Adapter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+	return backend, adapterMAC
+}
+
+// newTUIModel applies the theme and builds the TUI's model from the
+// settings and the saved state. It exits on a bad theme.
+func newTUIModel(cfg Config, backend Backend, adapterMAC string) Model {
+	palette, err := cfg.palette()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	applyPalette(palette.forTerminal(os.Getenv("NO_COLOR") != "", lipgloss.ColorProfile()))
+	m := initialModel(backend)
+	m.timeouts = cfg.Timeouts
+	m.keys, _ = newKeymap(cfg.Keys) // checked by loadConfig
+	m.lowBattery = cfg.LowBattery
+	m.scanDuration = cfg.ScanDuration
+	m.adapter = adapterMAC
+	if cfg.ASCII != nil {
+		m.ascii = *cfg.ASCII
+	} else {
+		m.ascii = !unicodeTerminal(os.Getenv("TERM"), envOr("LC_ALL", envOr("LC_CTYPE", os.Getenv("LANG"))))
+	}
+	if path, err := defaultStatePath(); err == nil {
+		// A broken state file only costs the saved sort order.
+		state, _ := loadState(path)
+		m.sortMode, m.grouped = state.Sort, state.Grouped
+		if state.LastSeen != nil {
+			m.lastSeen = state.LastSeen
+		}
+		m.statePath = path
+	}
+	return m
+}
+
+// loadUserConfig loads path, or the default config file when path is
+// empty, in which case the file may be missing.
+func loadUserConfig(path string) (Config, error) {
+	if path != "" {
+		return loadConfig(path, true)
+	}
+	path, err := defaultConfigPath()
+	if err != nil {
+		return defaultConfig(), nil
+	}
+	return loadConfig(path, false)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
 func printUsage() {
 	fmt.Println(`hyprBluetooth - terminal Bluetooth device manager
 
 Usage:
-  hyprBluetooth          launch the interactive TUI
-  hyprBluetooth --help   show this message
-  hyprBluetooth --version  print version information`)
+  hyprBluetooth [flags]                     launch the interactive TUI
+  hyprBluetooth [flags] <command> [args]    run a single command and exit
+  hyprBluetooth --help                      show this message
+  hyprBluetooth --version                   print version information
+
+Commands:`)
+	printCommandUsage(os.Stdout)
+	fmt.Println(`
+Flags:
+  --config FILE                      settings file (default
+                                     $XDG_CONFIG_HOME/hyprBluetooth/config.toml)
+  --backend auto|dbus|bluetoothctl   Bluetooth backend (default auto)
+  --adapter MAC|name                 Bluetooth controller to use (default:
+                                     the system default controller)
+  --low-battery N                    warn when a connected device's battery
+                                     is at or below N percent (default 20)
+  --theme NAME|FILE                  color theme: default, catppuccin, gruvbox,
+                                     nord, high-contrast, monochrome, or a
+                                     user theme (default: the config's theme)
+  --ascii                            draw with plain ASCII instead of emoji and
+                                     symbols (default: only on the Linux
+                                     console or a non-UTF-8 locale)
+  --scan-duration D                  stop scanning in the TUI after D, e.g.
+                                     30s (default 0: scan until 's' is
+                                     pressed again)
+
+Exit status is 0 on success, 1 if the operation failed, 2 on bad usage
+and 3 if a device name or MAC could not be resolved.
+
+Environment (overrides the config file):
+  HYPRBLUETOOTH_BACKEND  default for --backend
+  HYPRBLUETOOTH_ADAPTER  default for --adapter
+  HYPRBLUETOOTH_SCAN_DURATION  default for --scan-duration`)
 }
 
-func initialModel() Model {
+func initialModel(backend Backend) Model {
 	return Model{
+		backend:          backend,
 		devices:          []BluetoothDevice{},
 		cursor:           0,
 		scanning:         false,
@@ -50,5 +234,10 @@ func initialModel() Model {
 		height:           24,
 		bluetoothEnabled: false,
 		bluetoothChecked: false,
+		lowBattery:       lowBatteryThreshold,
+		timeouts:         defaultTimeouts,
+		keys:             defaultKeymap,
+		sortMode:         sortDefault,
+		lastSeen:         map[string]time.Time{},
 	}
 }
@@ -1,57 +1,43 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"maps"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
+// The styles are built from a palette by applyPalette.
 var (
-	titleStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#FAFAFA")).
-			Background(lipgloss.Color("#7D56F4")).
-			Padding(0, 1).
-			Bold(true)
-
-	btOnStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(lipgloss.Color("#04B575"))
-
-	btOffStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(lipgloss.Color("#FF5F56"))
-
-	scanStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#04B575")).
-			Bold(true)
-
-	disabledStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#FF5F56")).
-			Italic(true)
-
-	noDevicesStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#626262")).
-			Italic(true)
-
-	helpStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#626262")).
-			MarginTop(2)
-
-	errorStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#FF5F56")).
-			Bold(true).
-			MarginTop(1)
-
-	cursorRowStyle = lipgloss.NewStyle().Background(lipgloss.Color("#383838"))
-
-	statusConnectedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#04B575"))
-	statusPairedStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFA500"))
-	statusUnpairedStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#626262"))
+	titleStyle           lipgloss.Style
+	btOnStyle            lipgloss.Style
+	btOffStyle           lipgloss.Style
+	scanStyle            lipgloss.Style
+	disabledStyle        lipgloss.Style
+	noDevicesStyle       lipgloss.Style
+	helpStyle            lipgloss.Style
+	errorStyle           lipgloss.Style
+	cursorRowStyle       lipgloss.Style
+	groupHeaderStyle     lipgloss.Style
+	scrollIndicatorStyle lipgloss.Style
+	statusConnectedStyle lipgloss.Style
+	statusPairedStyle    lipgloss.Style
+	statusUnpairedStyle  lipgloss.Style
+	statusBlockedStyle   lipgloss.Style
+	batteryHighStyle     lipgloss.Style
+	batteryMidStyle      lipgloss.Style
+	batteryLowStyle      lipgloss.Style
+	warningStyle         lipgloss.Style
+	dialogStyle          lipgloss.Style
+	passkeyStyle         lipgloss.Style
 )
 
 type Model struct {
+	backend          Backend
 	devices          []BluetoothDevice
 	cursor           int
 	scanning         bool
@@ -60,15 +46,147 @@ type Model struct {
 	bluetoothEnabled bool
 	bluetoothChecked bool
 	statusText       string
+	// lowBattery is the percentage at or below which a connected device's
+	// battery is flagged in the status line.
+	lowBattery int
+	// ascii swaps every emoji and symbol, down to the device category
+	// icons, for plain ASCII.
+	ascii bool
+	// sortMode orders the list and grouped splits it into Connected,
+	// Paired and Available sections. lastSeen feeds the last-seen order.
+	sortMode sortMode
+	grouped  bool
+	lastSeen map[string]time.Time
+	// statePath is where the sort choice and lastSeen are kept between
+	// runs; empty disables saving.
+	statePath string
+
+	// scroll is the first row of listRows on screen when the list is
+	// taller than the window.
+	scroll int
+	// events is the live backend subscription; nil means we fall back to
+	// re-listing devices after each action.
+	events       <-chan Event
+	eventsCancel context.CancelFunc
+
+	// timeouts bound the backend calls the TUI makes.
+	timeouts Timeouts
+
+	// keys maps keys to the device list's actions; pending is the start
+	// of a chord typed so far.
+	keys    keymap
+	pending string
+
+	// scanDuration stops discovery after the given time; 0 scans until
+	// 's' is pressed again.
+	scanDuration time.Duration
+	// scanSeq tells the current scan's start apart from one the user has
+	// already stopped. found streams what discovery turns up and
+	// scanCancel stops it; scanFound counts distinct devices seen.
+	scanSeq     int
+	scanStarted time.Time
+	scanFound   map[string]struct{}
+	found       <-chan BluetoothDevice
+	scanCancel  context.CancelFunc
+	// scanFilter applies to every scan; filtering is set while its
+	// key=value form is edited in filterInput.
+	scanFilter  DiscoveryFilter
+	filtering   bool
+	filterInput string
+
+	// renaming is the address of the device whose new name is being typed
+	// into renameInput.
+	renaming    string
+	renameInput string
+
+	// adapters are the local controllers; adapter is the selected one's
+	// address, empty for the default controller.
+	adapters []Adapter
+	adapter  string
+
+	// pairing is the agent prompt currently shown as a modal, if any.
+	pairing         *PairingRequest
+	pairingInput    string
+	pairingDeadline time.Time
+	pairingSeq      int
+	pairingRequests <-chan *PairingRequest
+
+	// confirm is a yes/no question that runs its command on "y".
+	confirm *confirmPrompt
+
+	// profiles is the open per-profile view, if any.
+	profiles *profileView
+
+	// settings is the open adapter settings screen, if any.
+	settings *settingsView
+
+	// search narrows the list to devices whose name, alias or MAC contains
+	// it; searching is set while it is being typed.
+	search    string
+	searching bool
+
+	// details shows everything known about the selected device, beside
+	// the list on wide terminals and instead of it otherwise.
+	details bool
 }
 
+// detailSplitWidth is the terminal width from which the detail pane is
+// drawn next to the device list.
+const detailSplitWidth = 110
+
+type confirmPrompt struct {
+	question string
+	cmd      tea.Cmd
+}
+
+// profileView lists one device's services so they can be connected or
+// disconnected individually.
+type profileView struct {
+	mac    string
+	cursor int
+}
+
+// settingsView edits the selected adapter's settings, one row per
+// adapterSettingKeys entry. adapter is nil until the current values load.
+type settingsView struct {
+	adapter *Adapter
+	cursor  int
+	// editing is set while a new alias is typed into input.
+	editing bool
+	input   string
+}
+
+// maxAliasLength is the longest name BlueZ accepts, in bytes.
+const maxAliasLength = 248
+
+// devicesMsg, bluetoothStatusMsg and eventsSubscribedMsg carry the adapter
+// they were fetched for so those still in flight when the user switches
+// adapters can be ignored.
 type devicesMsg struct {
+	adapter string
 	devices []BluetoothDevice
 }
 
-type scanCompleteMsg struct {
-	devices []BluetoothDevice
-	err     error
+type scanStartedMsg struct {
+	seq    int
+	found  <-chan BluetoothDevice
+	cancel context.CancelFunc
+	err    error
+}
+
+// scanDeviceMsg, scanStoppedMsg and scanTickMsg carry their stream so those
+// from a scan we've since stopped can be ignored.
+type scanDeviceMsg struct {
+	device BluetoothDevice
+	found  <-chan BluetoothDevice
+}
+
+type scanStoppedMsg struct {
+	found <-chan BluetoothDevice
+}
+
+type scanTickMsg struct {
+	found <-chan BluetoothDevice
 }
 
 type deviceStatusMsg struct {
@@ -77,22 +195,85 @@ type deviceStatusMsg struct {
 }
 
 type bluetoothStatusMsg struct {
+	adapter string
 	enabled bool
 	err     error
 }
 
+type deviceRemovedMsg struct {
+	deviceMAC string
+}
+
+type deviceUpdatedMsg struct {
+	device BluetoothDevice
+}
+
+type eventsSubscribedMsg struct {
+	adapter string
+	events  <-chan Event
+	cancel  context.CancelFunc
+	err     error
+}
+
+// backendEventMsg and eventStreamClosedMsg carry their stream so messages
+// from a subscription we've since replaced can be ignored.
+type backendEventMsg struct {
+	event  Event
+	events <-chan Event
+}
+
+type eventStreamClosedMsg struct {
+	events <-chan Event
+}
+
+type adaptersMsg struct {
+	adapters []Adapter
+}
+
+type adapterInfoMsg struct {
+	adapter Adapter
+}
+
+type agentRegisteredMsg struct {
+	requests <-chan *PairingRequest
+	err      error
+}
+
+type pairingRequestMsg struct {
+	request *PairingRequest
+}
+
+type pairingTickMsg struct {
+	seq int
+}
+
 type errorMsg struct {
 	err error
 }
 
 func (m Model) Init() tea.Cmd {
 	return tea.Batch(
-		getDevicesCmd(),
-		getBluetoothStatusCmd(),
+		getDevicesCmd(m.backend, m.timeouts, m.adapter),
+		getBluetoothStatusCmd(m.backend, m.timeouts, m.adapter),
+		subscribeEventsCmd(m.backend, m.adapter),
+		registerAgentCmd(m.backend),
+		listAdaptersCmd(m.backend, m.timeouts),
 	)
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	updated, cmd := m.update(msg)
+	next := updated.(Model)
+	// A chord can't be finished in a dialog, whether a key opened it or
+	// BlueZ did with a pairing request.
+	if next.modalOpen() || next.searching {
+		next.pending = ""
+	}
+	next.scrollToCursor()
+	return next, cmd
+}
+
+func (m Model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
@@ -104,271 +285,1693 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.MouseMsg:
 		return m.handleMouseMsg(msg)
 
-	case scanCompleteMsg:
-		m.scanning = false
-		if msg.err != nil {
-			m.statusText = msg.err.Error()
-		} else {
-			m.devices = msg.devices
-			m.statusText = ""
-		}
-		m.clampCursor()
+	case scanStartedMsg, scanDeviceMsg, scanStoppedMsg, scanTickMsg:
+		return m.updateScan(msg)
 
-	case deviceStatusMsg:
-		return m.handleDeviceStatusMsg(msg)
+	case devicesMsg, deviceStatusMsg, deviceUpdatedMsg, deviceRemovedMsg, bluetoothStatusMsg:
+		return m.updateDevices(msg)
 
-	case devicesMsg:
-		m.devices = msg.devices
-		m.statusText = ""
-		m.clampCursor()
+	case eventsSubscribedMsg, backendEventMsg, eventStreamClosedMsg, adaptersMsg, adapterInfoMsg:
+		return m.updateBackend(msg)
 
-	case bluetoothStatusMsg:
-		return m.handleBluetoothStatusMsg(msg)
+	case agentRegisteredMsg, pairingRequestMsg, pairingTickMsg:
+		return m.updatePairing(msg)
 
 	case errorMsg:
 		m.statusText = msg.err.Error()
+		if m.pairing != nil && !m.pairing.NeedsReply() {
+			m.closePairing()
+		}
 	}
 
 	return m, nil
 }
 
-func (m *Model) clampCursor() {
-	if m.cursor >= len(m.devices) {
-		m.cursor = max(0, len(m.devices)-1)
-	}
-}
+// updateScan handles the messages of a running scan.
+func (m Model) updateScan(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case scanStartedMsg:
+		return m.handleScanStartedMsg(msg)
 
-func (m Model) deviceListOffset() int {
-	offset := 2 // title + blank line
-	if m.bluetoothChecked {
-		offset++ // bluetooth status line
-	}
-	if m.scanning {
-		offset += 2 // scanning text + blank line
+	case scanDeviceMsg:
+		return m.handleScanDeviceMsg(msg)
+
+	case scanStoppedMsg:
+		if msg.found == m.found {
+			m.stopScan()
+		}
+
+	case scanTickMsg:
+		if msg.found == m.found && m.scanning {
+			return m, scanTickCmd(m.found)
+		}
 	}
-	return offset
+	return m, nil
 }
 
-func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	m.statusText = ""
+// updateDevices handles the results of listing and acting on devices.
+func (m Model) updateDevices(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case devicesMsg:
+		return m.handleDevicesMsg(msg)
 
-	switch msg.String() {
-	case "ctrl+c", "q":
-		return m, tea.Quit
+	case deviceStatusMsg:
+		return m.handleDeviceStatusMsg(msg)
 
-	case "up", "k":
-		if m.cursor > 0 {
-			m.cursor--
-		}
+	case deviceUpdatedMsg:
+		return m.handleDeviceUpdatedMsg(msg)
 
-	case "down", "j":
-		if m.cursor < len(m.devices)-1 {
-			m.cursor++
-		}
+	case deviceRemovedMsg:
+		m.devices = applyDeviceEvent(m.devices, Event{Kind: EventDeviceRemoved, Device: BluetoothDevice{MAC: msg.deviceMAC}})
+		m.clampCursor()
+		m.statusText = ""
+
+	case bluetoothStatusMsg:
+		return m.handleBluetoothStatusMsg(msg)
+	}
+	return m, nil
+}
+
+// updateBackend handles the backend's event stream and adapters.
+func (m Model) updateBackend(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case eventsSubscribedMsg:
+		return m.handleEventsSubscribedMsg(msg)
 
-	case "enter", " ":
-		return m.handleDeviceAction()
+	case backendEventMsg:
+		if msg.events != m.events {
+			return m, nil
+		}
+		m.applyEvent(msg.event)
+		return m, waitForEventCmd(m.events)
 
-	case "s":
-		if !m.scanning {
-			m.scanning = true
-			return m, scanDevicesCmd()
+	case eventStreamClosedMsg:
+		if msg.events != m.events {
+			return m, nil
 		}
+		m.events = nil
+		return m, getDevicesCmd(m.backend, m.timeouts, m.adapter)
 
-	case "r":
-		return m, getDevicesCmd()
+	case adaptersMsg:
+		m.adapters = msg.adapters
 
-	case "d":
-		return m.handleDisconnectAction()
+	case adapterInfoMsg:
+		return m.handleAdapterInfoMsg(msg)
+	}
+	return m, nil
+}
 
-	case "p":
-		return m.handlePairAction()
+// updatePairing handles the pairing agent and its prompts.
+func (m Model) updatePairing(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case agentRegisteredMsg:
+		if msg.err != nil {
+			m.statusText = msg.err.Error()
+			return m, nil
+		}
+		m.pairingRequests = msg.requests
+		return m, waitForPairingRequestCmd(m.pairingRequests)
 
-	case "e":
-		return m.handleBluetoothToggle()
+	case pairingRequestMsg:
+		return m.handlePairingRequestMsg(msg)
 
-	case "ctrl+r":
-		return m, tea.Batch(
-			getDevicesCmd(),
-			getBluetoothStatusCmd(),
-		)
+	case pairingTickMsg:
+		return m.handlePairingTickMsg(msg)
 	}
-
 	return m, nil
 }
 
-func (m Model) handleDeviceAction() (tea.Model, tea.Cmd) {
-	if len(m.devices) == 0 {
+func (m Model) handleScanStartedMsg(msg scanStartedMsg) (tea.Model, tea.Cmd) {
+	if msg.seq != m.scanSeq || !m.scanning {
+		if msg.cancel != nil {
+			msg.cancel()
+		}
+		return m, nil
+	}
+	if msg.err != nil {
+		m.stopScan()
+		m.statusText = msg.err.Error()
 		return m, nil
 	}
+	m.found, m.scanCancel = msg.found, msg.cancel
+	return m, tea.Batch(waitForScanDeviceCmd(m.found), scanTickCmd(m.found))
+}
 
-	device := m.devices[m.cursor]
-	switch {
-	case device.Connected:
-		return m, disconnectDeviceCmd(device.MAC)
-	case device.Paired:
-		return m, connectDeviceCmd(device.MAC)
-	default:
-		return m, pairAndConnectDeviceCmd(device.MAC)
+func (m Model) handleScanDeviceMsg(msg scanDeviceMsg) (tea.Model, tea.Cmd) {
+	if msg.found != m.found {
+		return m, nil
+	}
+	// Devices already listed are kept up to date even if they don't
+	// match; the filter only keeps new ones out.
+	matches := m.scanFilter.Matches(msg.device)
+	if _, known := m.deviceByMAC(msg.device.MAC); known || matches {
+		m.devices = upsertDevice(m.devices, msg.device)
+		m.markSeen(msg.device)
+		m.sortDevices()
 	}
+	if matches {
+		m.scanFound[msg.device.MAC] = struct{}{}
+	}
+	return m, waitForScanDeviceCmd(m.found)
 }
 
-func (m Model) handleDisconnectAction() (tea.Model, tea.Cmd) {
-	if len(m.devices) > 0 {
-		device := m.devices[m.cursor]
-		if device.Connected {
-			return m, disconnectDeviceCmd(device.MAC)
-		}
+func (m Model) handleDevicesMsg(msg devicesMsg) (tea.Model, tea.Cmd) {
+	if msg.adapter != m.adapter {
+		return m, nil
 	}
+	m.devices = msg.devices
+	m.markSeen(m.devices...)
+	m.statusText = ""
+	m.sortDevices()
+	m.clampCursor()
 	return m, nil
 }
 
-func (m Model) handlePairAction() (tea.Model, tea.Cmd) {
-	if len(m.devices) > 0 {
-		device := m.devices[m.cursor]
-		if !device.Paired {
-			return m, pairDeviceCmd(device.MAC)
-		}
+func (m Model) handleDeviceUpdatedMsg(msg deviceUpdatedMsg) (tea.Model, tea.Cmd) {
+	m.devices = upsertDevice(m.devices, msg.device)
+	m.markSeen(msg.device)
+	m.statusText = ""
+	m.sortDevices()
+	if m.pairing != nil && !m.pairing.NeedsReply() {
+		m.closePairing()
 	}
 	return m, nil
 }
 
-func (m Model) handleBluetoothToggle() (tea.Model, tea.Cmd) {
-	if m.bluetoothChecked {
-		if m.bluetoothEnabled {
-			return m, disableBluetoothCmd()
+func (m Model) handleEventsSubscribedMsg(msg eventsSubscribedMsg) (tea.Model, tea.Cmd) {
+	if msg.adapter != m.adapter {
+		if msg.cancel != nil {
+			msg.cancel()
+		}
+		return m, nil
+	}
+	if msg.err != nil || msg.events == nil {
+		return m, nil
+	}
+	m.events, m.eventsCancel = msg.events, msg.cancel
+	return m, waitForEventCmd(m.events)
+}
+
+func (m Model) handleAdapterInfoMsg(msg adapterInfoMsg) (tea.Model, tea.Cmd) {
+	for i, a := range m.adapters {
+		if strings.EqualFold(a.MAC, msg.adapter.MAC) {
+			m.adapters[i] = msg.adapter
+			m.adapters[i].Default = a.Default
 		}
-		return m, enableBluetoothCmd()
+	}
+	if m.settings != nil {
+		m.settings.adapter = &msg.adapter
 	}
 	return m, nil
 }
 
-func (m Model) handleMouseMsg(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
-	if msg.Action != tea.MouseActionPress {
+func (m Model) handlePairingTickMsg(msg pairingTickMsg) (tea.Model, tea.Cmd) {
+	if m.pairing == nil || msg.seq != m.pairingSeq {
 		return m, nil
 	}
+	if time.Now().After(m.pairingDeadline) {
+		m.pairing.Reject()
+		m.closePairing()
+		m.statusText = "pairing request timed out"
+		return m, nil
+	}
+	return m, pairingTickCmd(m.pairingSeq)
+}
 
-	switch msg.Button {
-	case tea.MouseButtonWheelUp:
-		if m.cursor > 0 {
-			m.cursor--
-		}
-	case tea.MouseButtonWheelDown:
-		if m.cursor < len(m.devices)-1 {
-			m.cursor++
-		}
-	case tea.MouseButtonLeft:
-		offset := m.deviceListOffset()
-		if msg.Y >= offset && msg.Y < offset+len(m.devices) {
-			newCursor := msg.Y - offset
-			if newCursor >= 0 && newCursor < len(m.devices) {
-				m.cursor = newCursor
-			}
+func (m *Model) startScan() tea.Cmd {
+	m.scanSeq++
+	m.scanning = true
+	m.scanStarted = time.Now()
+	m.scanFound = map[string]struct{}{}
+	return startScanCmd(m.backend, m.scanDuration, m.scanFilter, m.scanSeq)
+}
+
+// stopScan cancels discovery, if it got as far as starting, and forgets
+// its stream.
+func (m *Model) stopScan() {
+	if m.scanCancel != nil {
+		m.scanCancel()
+	}
+	m.scanning = false
+	m.found, m.scanCancel = nil, nil
+}
+
+// scanBanner shows how long discovery has run, against its limit if it
+// has one, and how many devices it found.
+func (m Model) scanBanner() string {
+	elapsed := time.Since(m.scanStarted).Truncate(time.Second)
+	progress := formatClock(elapsed)
+	if m.scanDuration > 0 {
+		progress += " / " + formatClock(m.scanDuration)
+	}
+	banner := decorate(m.glyphs().scanning, fmt.Sprintf("Scanning for devices... %s, %d found", progress, len(m.scanFound)))
+	if !m.scanFilter.empty() {
+		banner += "  filter: " + m.scanFilter.String()
+	}
+	return banner + fmt.Sprintf("  (%s: stop)", m.keys.key(actScan, m.glyphs()))
+}
+
+func (m Model) glyphs() glyphSet {
+	return glyphsFor(m.ascii)
+}
+
+// dialog draws s in a box, with an ASCII border in ASCII mode.
+func (m Model) dialog(s string) string {
+	return dialogStyle.Border(m.glyphs().border).Render(s)
+}
+
+// formatClock renders d as m:ss.
+func formatClock(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d", int(d/time.Minute), int(d%time.Minute/time.Second))
+}
+
+// clampCursor keeps the cursor on a listed device, moving it to the first
+// search match if the device it was on no longer matches.
+func (m *Model) clampCursor() {
+	if m.cursor >= len(m.devices) {
+		m.cursor = max(0, len(m.devices)-1)
+	}
+	if _, ok := m.selectedDevice(); !ok {
+		if visible := m.visibleDevices(); len(visible) > 0 {
+			m.cursor = visible[0]
 		}
 	}
-	return m, nil
 }
 
-func (m Model) handleDeviceStatusMsg(msg deviceStatusMsg) (tea.Model, tea.Cmd) {
-	for i, device := range m.devices {
-		if device.MAC == msg.deviceMAC {
-			m.devices[i].Connected = msg.connected
-			break
+// visibleDevices lists the indexes into m.devices that the list shows.
+func (m Model) visibleDevices() []int {
+	visible := make([]int, 0, len(m.devices))
+	for i, d := range m.devices {
+		if deviceMatches(d, m.search) {
+			visible = append(visible, i)
 		}
 	}
-	return m, getDevicesCmd()
+	return visible
 }
 
-func (m Model) handleBluetoothStatusMsg(msg bluetoothStatusMsg) (tea.Model, tea.Cmd) {
-	m.bluetoothChecked = true
-	if msg.err != nil {
-		m.statusText = msg.err.Error()
-		return m, nil
+// listRow is one line of the device list: a section header, or the index
+// of a device in m.devices (header is then "").
+type listRow struct {
+	header string
+	device int
+}
+
+// listRows lays out the visible devices, with a header before each
+// section when grouped. sortDevices keeps sections contiguous.
+func (m Model) listRows() []listRow {
+	visible := m.visibleDevices()
+	if !m.grouped {
+		rows := make([]listRow, len(visible))
+		for r, i := range visible {
+			rows[r] = listRow{device: i}
+		}
+		return rows
 	}
-	m.bluetoothEnabled = msg.enabled
-	m.statusText = ""
-	if msg.enabled {
-		return m, getDevicesCmd()
+	counts := make(map[deviceGroup]int)
+	for _, i := range visible {
+		counts[groupOf(m.devices[i])]++
 	}
-	return m, nil
+	rows := make([]listRow, 0, len(visible)+len(counts))
+	for r, i := range visible {
+		g := groupOf(m.devices[i])
+		if r == 0 || groupOf(m.devices[visible[r-1]]) != g {
+			rows = append(rows, listRow{header: fmt.Sprintf("%s (%d)", deviceGroupTitles[g], counts[g]), device: -1})
+		}
+		rows = append(rows, listRow{device: i})
+	}
+	return rows
 }
 
-func (m Model) View() string {
-	var s strings.Builder
-
-	s.WriteString(titleStyle.Render("HyprBluetooth - Bluetooth Device Manager"))
-	s.WriteString("\n")
+// selectedDevice is the device under the cursor, if it is on screen.
+func (m Model) selectedDevice() (BluetoothDevice, bool) {
+	if m.cursor >= len(m.devices) || !deviceMatches(m.devices[m.cursor], m.search) {
+		return BluetoothDevice{}, false
+	}
+	return m.devices[m.cursor], true
+}
 
-	if m.bluetoothChecked {
-		if m.bluetoothEnabled {
-			s.WriteString(btOnStyle.Render("🔵 Bluetooth: ON"))
-		} else {
-			s.WriteString(btOffStyle.Render("🔴 Bluetooth: OFF"))
+// moveCursor steps through the visible devices.
+func (m *Model) moveCursor(delta int) {
+	visible := m.visibleDevices()
+	if len(visible) == 0 {
+		return
+	}
+	pos := 0
+	for i, idx := range visible {
+		if idx == m.cursor {
+			pos = min(max(i+delta, 0), len(visible)-1)
+			break
 		}
-		s.WriteString("\n")
 	}
-	s.WriteString("\n")
+	m.cursor = visible[pos]
+}
 
-	if m.scanning {
-		s.WriteString(scanStyle.Render("🔍 Scanning for devices..."))
-		s.WriteString("\n\n")
+// listHeight is how many lines the device list may take without pushing
+// the help off screen.
+func (m Model) listHeight() int {
+	return max(m.height-m.deviceListOffset()-lipgloss.Height(m.footerView()), 3)
+}
+
+// pageSize is how many rows are on screen at once; when they don't all
+// fit, two lines go to the scroll indicators.
+func (m Model) pageSize() int {
+	if h := m.listHeight(); len(m.listRows()) > h {
+		return h - 2
 	}
+	return m.listHeight()
+}
 
-	if m.bluetoothChecked && !m.bluetoothEnabled {
-		s.WriteString(disabledStyle.Render("Bluetooth is disabled. Press 'e' to enable."))
-		s.WriteString("\n")
-	} else if len(m.devices) == 0 {
-		s.WriteString(noDevicesStyle.Render("No devices found. Press 's' to scan for devices."))
-		s.WriteString("\n")
-	} else {
-		for i, device := range m.devices {
-			cursor := " "
-			if m.cursor == i {
-				cursor = ">"
-			}
+// viewport returns listRows with the range on screen. scroll is clamped
+// here as well because a resize can leave it past the end.
+func (m Model) viewport() (rows []listRow, start, end int) {
+	rows = m.listRows()
+	page := m.pageSize()
+	if len(rows) <= page {
+		return rows, 0, len(rows)
+	}
+	start = min(max(m.scroll, 0), len(rows)-page)
+	return rows, start, start + page
+}
 
-			var glyph string
-			var style lipgloss.Style
-			switch {
-			case device.Connected:
-				glyph, style = "●", statusConnectedStyle
-			case device.Paired:
-				glyph, style = "◐", statusPairedStyle
-			default:
-				glyph, style = "○", statusUnpairedStyle
-			}
+// scrollToCursor scrolls the least needed to keep the cursor's row, and
+// its section header, on screen.
+func (m *Model) scrollToCursor() {
+	rows, start, end := m.viewport()
+	m.scroll = start
+	for r, row := range rows {
+		if row.device != m.cursor {
+			continue
+		}
+		top := r
+		if r > 0 && rows[r-1].device < 0 {
+			top-- // show the section header too
+		}
+		if top < start {
+			m.scroll = top
+		} else if r >= end {
+			m.scroll = r + 1 - (end - start)
+		}
+		return
+	}
+}
 
-			deviceName := device.Name
-			if deviceName == "" {
-				deviceName = "Unknown Device"
-			}
+func (m *Model) applyEvent(ev Event) {
+	if ev.Kind == EventPowerChanged {
+		m.bluetoothChecked = true
+		m.bluetoothEnabled = ev.Powered
+		return
+	}
+	m.devices = applyDeviceEvent(m.devices, ev)
+	if ev.Kind != EventDeviceRemoved {
+		m.markSeen(ev.Device)
+	}
+	m.sortDevices()
+	m.clampCursor()
+}
 
-			line := fmt.Sprintf("%s %s %s (%s)",
-				cursor,
-				style.Render(glyph),
-				deviceName,
-				device.MAC)
+// markSeen records devices that are connected or were just heard.
+func (m *Model) markSeen(devices ...BluetoothDevice) {
+	now := time.Now()
+	for _, d := range devices {
+		if d.Connected || d.HasRSSI {
+			m.lastSeen[d.MAC] = now
+		}
+	}
+}
 
-			if m.cursor == i {
-				line = cursorRowStyle.Render(line)
-			}
+// lastSeenMaxAge is how long a device that's no longer listed keeps its
+// last-seen time, so the state file doesn't collect every device a scan
+// has ever heard.
+const lastSeenMaxAge = 30 * 24 * time.Hour
+
+// state copies what is saved between runs; saveStateCmd writes it from
+// another goroutine, so it mustn't share lastSeen with the model.
+func (m Model) state() uiState {
+	listed := make(map[string]bool, len(m.devices))
+	for _, d := range m.devices {
+		listed[d.MAC] = true
+	}
+	cutoff := time.Now().Add(-lastSeenMaxAge)
+	lastSeen := maps.Clone(m.lastSeen)
+	maps.DeleteFunc(lastSeen, func(mac string, seen time.Time) bool {
+		return !listed[mac] && seen.Before(cutoff)
+	})
+	return uiState{Sort: m.sortMode, Grouped: m.grouped, LastSeen: lastSeen}
+}
 
-			s.WriteString(line)
-			s.WriteString("\n")
+// sortDevices applies the sort mode and grouping, keeping the cursor on
+// the same device.
+func (m *Model) sortDevices() {
+	if (m.sortMode == sortDefault && !m.grouped) || len(m.devices) == 0 {
+		return
+	}
+	var selected string
+	if m.cursor < len(m.devices) {
+		selected = m.devices[m.cursor].MAC
+	}
+	sortDeviceList(m.devices, m.sortMode, m.grouped, m.lastSeen)
+	for i, d := range m.devices {
+		if d.MAC == selected {
+			m.cursor = i
+			break
 		}
 	}
+}
 
-	if m.statusText != "" {
-		s.WriteString(errorStyle.Render("Error: " + m.statusText))
-		s.WriteString("\n")
+func (m Model) deviceListOffset() int {
+	offset := 2 // title + blank line
+	if len(m.adapters) > 1 {
+		offset++ // adapter selector
+	}
+	if m.bluetoothChecked {
+		offset++ // bluetooth status line
+	}
+	if m.scanning {
+		offset += 2 // scanning text + blank line
+	}
+	if m.searching || m.search != "" {
+		offset++ // search prompt
 	}
+	return offset
+}
 
-	help := `
-Controls:
-  ↑/k, ↓/j: Navigate  Enter/Space: Connect/Disconnect  s: Scan  r: Refresh
-  p: Pair  d: Disconnect  e: Enable/Disable Bluetooth  Ctrl+r: Full Refresh  q: Quit
+func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.statusText = ""
+
+	if m.pairing != nil {
+		return m.handlePairingKey(msg)
+	}
+	if m.confirm != nil {
+		return m.handleConfirmKey(msg)
+	}
+	if m.profiles != nil {
+		return m.handleProfileKey(msg)
+	}
+	if m.settings != nil {
+		return m.handleSettingsKey(msg)
+	}
+	if m.filtering {
+		return m.handleFilterKey(msg)
+	}
+	if m.renaming != "" {
+		return m.handleRenameKey(msg)
+	}
+	if m.searching {
+		return m.handleSearchKey(msg)
+	}
+	if msg.String() == keyCtrlC {
+		return m, tea.Quit
+	}
 
-Status: ● Connected  ◐ Paired  ○ Unpaired`
+	a, ok := m.keyAction(msg)
+	if !ok {
+		return m, nil
+	}
+	if handle, ok := actionHandlers[a]; ok {
+		return handle(m)
+	}
+	return m, nil
+}
+
+// actionHandlers runs the device list's actions.
+var actionHandlers = map[action]func(Model) (tea.Model, tea.Cmd){
+	actQuit:            func(m Model) (tea.Model, tea.Cmd) { return m, tea.Quit },
+	actUp:              cursorAction(func(Model) int { return -1 }),
+	actDown:            cursorAction(func(Model) int { return 1 }),
+	actPageUp:          cursorAction(func(m Model) int { return -m.pageSize() }),
+	actPageDown:        cursorAction(func(m Model) int { return m.pageSize() }),
+	actTop:             cursorAction(func(m Model) int { return -len(m.devices) }),
+	actBottom:          cursorAction(func(m Model) int { return len(m.devices) }),
+	actConnect:         Model.handleDeviceAction,
+	actSearch:          Model.handleSearchAction,
+	actClearSearch:     Model.handleClearSearchAction,
+	actScan:            Model.handleScanAction,
+	actRefresh:         Model.handleRefreshAction,
+	actSort:            Model.handleSortAction,
+	actGroup:           Model.handleGroupAction,
+	actDisconnect:      Model.handleDisconnectAction,
+	actPair:            Model.handlePairAction,
+	actTrust:           Model.handleTrustToggle,
+	actBlock:           Model.handleBlockToggle,
+	actRemove:          Model.handleRemoveAction,
+	actRename:          Model.handleRenameAction,
+	actDetails:         Model.handleDetailsAction,
+	actSwitchAdapter:   Model.handleAdapterSwitch,
+	actProfiles:        Model.handleProfilesAction,
+	actFilter:          Model.handleFilterAction,
+	actAdapterSettings: Model.handleAdapterSettingsAction,
+	actPower:           Model.handleBluetoothToggle,
+	actFullRefresh:     Model.handleFullRefresh,
+}
+
+// cursorAction moves the cursor by the number of rows delta works out.
+func cursorAction(delta func(Model) int) func(Model) (tea.Model, tea.Cmd) {
+	return func(m Model) (tea.Model, tea.Cmd) {
+		m.moveCursor(delta(m))
+		return m, nil
+	}
+}
+
+func (m Model) handleSearchAction() (tea.Model, tea.Cmd) {
+	m.searching = true
+	return m, nil
+}
+
+func (m Model) handleClearSearchAction() (tea.Model, tea.Cmd) {
+	m.search = ""
+	return m, nil
+}
+
+func (m Model) handleScanAction() (tea.Model, tea.Cmd) {
+	if m.scanning {
+		m.stopScan()
+		return m, nil
+	}
+	return m, m.startScan()
+}
+
+func (m Model) handleRefreshAction() (tea.Model, tea.Cmd) {
+	return m, getDevicesCmd(m.backend, m.timeouts, m.adapter)
+}
+
+func (m Model) handleFullRefresh() (tea.Model, tea.Cmd) {
+	return m, tea.Batch(
+		getDevicesCmd(m.backend, m.timeouts, m.adapter),
+		getBluetoothStatusCmd(m.backend, m.timeouts, m.adapter),
+	)
+}
+
+func (m Model) handleSortAction() (tea.Model, tea.Cmd) {
+	m.sortMode = m.sortMode.next()
+	return m, m.applySort()
+}
+
+func (m Model) handleGroupAction() (tea.Model, tea.Cmd) {
+	m.grouped = !m.grouped
+	return m, m.applySort()
+}
+
+func (m Model) handleRenameAction() (tea.Model, tea.Cmd) {
+	if device, ok := m.selectedDevice(); ok {
+		m.renaming, m.renameInput = device.MAC, device.DisplayName()
+	}
+	return m, nil
+}
+
+func (m Model) handleDetailsAction() (tea.Model, tea.Cmd) {
+	m.details = !m.details
+	return m, nil
+}
+
+func (m Model) handleProfilesAction() (tea.Model, tea.Cmd) {
+	if device, ok := m.selectedDevice(); ok {
+		m.profiles = &profileView{mac: device.MAC}
+	}
+	return m, nil
+}
+
+func (m Model) handleFilterAction() (tea.Model, tea.Cmd) {
+	m.filtering = true
+	m.filterInput = m.scanFilter.String()
+	return m, nil
+}
+
+func (m Model) handleAdapterSettingsAction() (tea.Model, tea.Cmd) {
+	m.settings = &settingsView{}
+	return m, adapterInfoCmd(m.backend, m.timeouts)
+}
+
+// keyAction maps msg, and any chord it completes, to an action. A key that
+// breaks off a chord is tried again on its own.
+func (m *Model) keyAction(msg tea.KeyMsg) (action, bool) {
+	seq := keyName(msg)
+	if m.pending != "" {
+		seq = m.pending + " " + seq
+	}
+	a, found, prefix := m.keys.lookup(seq)
+	switch {
+	case found:
+		m.pending = ""
+		return a, true
+	case prefix:
+		m.pending = seq
+		return "", false
+	}
+	retry := m.pending != ""
+	m.pending = ""
+	if retry {
+		return m.keyAction(msg)
+	}
+	return "", false
+}
+
+// applySort re-sorts after the sort settings change and saves them.
+func (m *Model) applySort() tea.Cmd {
+	save := saveStateCmd(m.statePath, m.state())
+	if m.sortMode == sortDefault && !m.grouped {
+		// Restore the backend's order.
+		return tea.Batch(save, getDevicesCmd(m.backend, m.timeouts, m.adapter))
+	}
+	m.sortDevices()
+	return save
+}
+
+// selectedAdapter is the index of the adapter in use, or -1 if unknown.
+func (m Model) selectedAdapter() int {
+	for i, a := range m.adapters {
+		if (m.adapter == "" && a.Default) || strings.EqualFold(a.MAC, m.adapter) {
+			return i
+		}
+	}
+	return -1
+}
+
+// handleAdapterSwitch moves to the next controller and restarts everything
+// that was bound to the previous one.
+func (m Model) handleAdapterSwitch() (tea.Model, tea.Cmd) {
+	if len(m.adapters) < 2 || m.scanning {
+		return m, nil
+	}
+	next, ok := m.nextAdapter()
+	if !ok {
+		m.statusText = errAdapterUnreachable.Error()
+		return m, nil
+	}
+	m.adapter = next.MAC
+	m.backend = m.backend.WithAdapter(next.MAC)
+	if m.eventsCancel != nil {
+		m.eventsCancel()
+	}
+	m.events, m.eventsCancel = nil, nil
+	m.devices = nil
+	m.cursor = 0
+	m.bluetoothChecked = false
+	return m, tea.Batch(
+		getDevicesCmd(m.backend, m.timeouts, m.adapter),
+		getBluetoothStatusCmd(m.backend, m.timeouts, m.adapter),
+		subscribeEventsCmd(m.backend, m.adapter),
+	)
+}
+
+// nextAdapter is the next adapter after the selected one that the backend
+// can reach.
+func (m Model) nextAdapter() (Adapter, bool) {
+	current := m.selectedAdapter()
+	for i := 1; i < len(m.adapters); i++ {
+		a := m.adapters[(current+i)%len(m.adapters)]
+		if adapterReachable(m.backend, a) {
+			return a, true
+		}
+	}
+	return Adapter{}, false
+}
+
+func (m Model) adapterView() string {
+	i := m.selectedAdapter()
+	if i < 0 {
+		return noDevicesStyle.Render("Adapter: " + m.adapter)
+	}
+	a := m.adapters[i]
+	name := a.Name
+	if name == "" {
+		name = a.MAC
+	}
+	return fmt.Sprintf("Adapter: %s (%s) %s", name, a.MAC, noDevicesStyle.Render(fmt.Sprintf("[%d/%d]  %s: switch", i+1, len(m.adapters), m.keys.key(actSwitchAdapter, m.glyphs()))))
+}
+
+func (m Model) handleDeviceAction() (tea.Model, tea.Cmd) {
+	device, ok := m.selectedDevice()
+	if !ok {
+		return m, nil
+	}
+
+	switch {
+	case device.Connected:
+		return m, disconnectDeviceCmd(m.backend, m.timeouts, device.MAC)
+	case device.Paired:
+		return m, connectDeviceCmd(m.backend, m.timeouts, device.MAC)
+	default:
+		return m, pairAndConnectDeviceCmd(m.backend, m.timeouts, device.MAC)
+	}
+}
+
+func (m Model) handleDisconnectAction() (tea.Model, tea.Cmd) {
+	if device, ok := m.selectedDevice(); ok {
+		if device.Connected {
+			return m, disconnectDeviceCmd(m.backend, m.timeouts, device.MAC)
+		}
+	}
+	return m, nil
+}
+
+func (m Model) handlePairAction() (tea.Model, tea.Cmd) {
+	if device, ok := m.selectedDevice(); ok {
+		if !device.Paired {
+			return m, pairDeviceCmd(m.backend, m.timeouts, device.MAC)
+		}
+	}
+	return m, nil
+}
+
+func (m Model) handleTrustToggle() (tea.Model, tea.Cmd) {
+	if device, ok := m.selectedDevice(); ok {
+		if device.Trusted {
+			return m, untrustDeviceCmd(m.backend, m.timeouts, device.MAC)
+		}
+		return m, trustDeviceCmd(m.backend, m.timeouts, device.MAC)
+	}
+	return m, nil
+}
+
+func (m Model) handleBlockToggle() (tea.Model, tea.Cmd) {
+	if device, ok := m.selectedDevice(); ok {
+		if device.Blocked {
+			return m, unblockDeviceCmd(m.backend, m.timeouts, device.MAC)
+		}
+		return m, blockDeviceCmd(m.backend, m.timeouts, device.MAC)
+	}
+	return m, nil
+}
+
+func (m Model) handleRemoveAction() (tea.Model, tea.Cmd) {
+	if device, ok := m.selectedDevice(); ok {
+		m.confirm = &confirmPrompt{
+			question: fmt.Sprintf("Remove %s? It will have to be paired again.", m.deviceLabel(device.MAC)),
+			cmd:      removeDeviceCmd(m.backend, m.timeouts, device.MAC),
+		}
+	}
+	return m, nil
+}
+
+// handleSearchKey edits the search, narrowing the list as each key is
+// typed. Enter keeps the search and returns to the list; Esc drops it.
+func (m Model) handleSearchKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch key := msg.String(); {
+	case key == keyCtrlC:
+		return m, tea.Quit
+	case key == keyEsc:
+		m.searching = false
+		m.search = ""
+	case key == keyEnter:
+		m.searching = false
+	case key == "up":
+		m.moveCursor(-1)
+	case key == "down":
+		m.moveCursor(1)
+	case key == keyBackspace:
+		if r := []rune(m.search); len(r) > 0 {
+			m.search = string(r[:len(r)-1])
+		}
+	case msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace:
+		m.search += string(msg.Runes)
+	}
+	m.clampCursor()
+	return m, nil
+}
+
+func (m Model) searchView() string {
+	prompt := "/" + m.search
+	if m.searching {
+		prompt += "_"
+	}
+	count := fmt.Sprintf("  %d of %d", len(m.visibleDevices()), len(m.devices))
+	hint := "  Esc: clear"
+	if m.searching {
+		hint = "  Enter: keep  Esc: clear"
+	}
+	return scanStyle.Render(prompt) + noDevicesStyle.Render(count+hint)
+}
+
+func (m Model) handleConfirmKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch k := keyName(msg); {
+	case k == keyCtrlC:
+		return m, tea.Quit
+	case k == "y", k == keyEnter:
+		cmd := m.confirm.cmd
+		m.confirm = nil
+		return m, cmd
+	case k == "n", m.closesDialog(k, actQuit):
+		m.confirm = nil
+	}
+	return m, nil
+}
+
+// closesDialog reports whether k closes a dialog opened by opener: Esc, the
+// opener's own key or the quit key.
+func (m Model) closesDialog(k string, opener action) bool {
+	return k == keyEsc || m.keys.has(opener, k) || m.keys.has(actQuit, k)
+}
+
+func (m Model) deviceByMAC(mac string) (BluetoothDevice, bool) {
+	for _, d := range m.devices {
+		if d.MAC == mac {
+			return d, true
+		}
+	}
+	return BluetoothDevice{}, false
+}
+
+func (m Model) handleProfileKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	device, ok := m.deviceByMAC(m.profiles.mac)
+	if !ok {
+		m.profiles = nil
+		return m, nil
+	}
+	profiles := deviceProfiles(device)
+	// The device may have been updated with fewer services since we opened.
+	m.profiles = &profileView{mac: device.MAC, cursor: min(m.profiles.cursor, max(0, len(profiles)-1))}
+
+	switch k := keyName(msg); {
+	case k == keyCtrlC:
+		return m, tea.Quit
+	case m.closesDialog(k, actProfiles):
+		m.profiles = nil
+	case m.keys.has(actUp, k):
+		if m.profiles.cursor > 0 {
+			m.profiles.cursor--
+		}
+	case m.keys.has(actDown, k):
+		if m.profiles.cursor < len(profiles)-1 {
+			m.profiles.cursor++
+		}
+	case m.keys.has(actConnect, k):
+		if len(profiles) > 0 {
+			return m, connectProfileCmd(m.backend, m.timeouts, device.MAC, profiles[m.profiles.cursor].UUID)
+		}
+	case m.keys.has(actDisconnect, k):
+		if len(profiles) > 0 {
+			return m, disconnectProfileCmd(m.backend, m.timeouts, device.MAC, profiles[m.profiles.cursor].UUID)
+		}
+	}
+	return m, nil
+}
+
+func (m Model) profilesView() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Profiles of %s\n\n", m.deviceLabel(m.profiles.mac))
+	device, _ := m.deviceByMAC(m.profiles.mac)
+	profiles := deviceProfiles(device)
+	if len(profiles) == 0 {
+		b.WriteString(noDevicesStyle.Render("The device advertises no services."))
+		b.WriteString("\n")
+	}
+	for i, p := range profiles {
+		cursor := " "
+		if i == m.profiles.cursor {
+			cursor = ">"
+		}
+		line := fmt.Sprintf("%s %-16s %s", cursor, p.Short, p.Name)
+		if p.Name != p.UUID {
+			line += noDevicesStyle.Render("  " + p.UUID)
+		}
+		if i == m.profiles.cursor {
+			line = cursorRowStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	var help []string
+	if k := m.keys.key(actConnect, m.glyphs()); k != "" {
+		help = append(help, k+": Connect profile")
+	}
+	if k := m.keys.key(actDisconnect, m.glyphs()); k != "" {
+		help = append(help, k+": Disconnect profile")
+	}
+	help = append(help, "Esc: Close")
+	b.WriteString("\n" + noDevicesStyle.Render(strings.Join(help, "  ")))
+	return m.dialog(b.String())
+}
+
+// handleSettingsKey moves between the adapter settings and changes the
+// selected one; the alias is edited in place by handleAliasKey.
+func (m Model) handleSettingsKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	v := m.settings
+	if msg.String() == keyCtrlC {
+		return m, tea.Quit
+	}
+	if v.editing {
+		return m.handleAliasKey(msg)
+	}
+
+	// Enter, Space and the arrows always change the setting; the rest
+	// follow the device list's bindings.
+	switch k := keyName(msg); {
+	case k == "left":
+		return m.changeAdapterSetting(-1)
+	case k == keyEnter, k == "space", k == "right":
+		return m.changeAdapterSetting(1)
+	case m.closesDialog(k, actAdapterSettings):
+		m.settings = nil
+	case m.keys.has(actUp, k):
+		if v.cursor > 0 {
+			v.cursor--
+		}
+	case m.keys.has(actDown, k):
+		if v.cursor < len(adapterSettingKeys)-1 {
+			v.cursor++
+		}
+	}
+	return m, nil
+}
+
+// handleAliasKey edits the adapter's new alias.
+func (m Model) handleAliasKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	v := m.settings
+	switch key := msg.String(); {
+	case key == keyEsc:
+		v.editing, v.input = false, ""
+	case key == keyEnter:
+		if v.input == "" {
+			return m, nil
+		}
+		alias := v.input
+		v.editing, v.input = false, ""
+		return m, configureAdapterCmd(m.backend, m.timeouts, AdapterSettings{Alias: &alias})
+	case key == keyBackspace:
+		if r := []rune(v.input); len(r) > 0 {
+			v.input = string(r[:len(r)-1])
+		}
+	case msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace:
+		if len(v.input)+len(string(msg.Runes)) <= maxAliasLength {
+			v.input += string(msg.Runes)
+		}
+	}
+	return m, nil
+}
+
+// changeAdapterSetting toggles the selected setting, steps its timeout by
+// step, or starts editing the alias.
+func (m Model) changeAdapterSetting(step int) (tea.Model, tea.Cmd) {
+	v := m.settings
+	if v.adapter == nil {
+		return m, nil
+	}
+
+	a := *v.adapter
+	var s AdapterSettings
+	switch adapterSettingKeys[v.cursor] {
+	case "alias":
+		v.editing, v.input = true, a.Name
+		return m, nil
+	case "discoverable":
+		on := !a.Discoverable
+		s.Discoverable = &on
+	case "discoverable-timeout":
+		d := nextTimeout(a.DiscoverableTimeout, step)
+		s.DiscoverableTimeout = &d
+	case "pairable":
+		on := !a.Pairable
+		s.Pairable = &on
+	case "pairable-timeout":
+		d := nextTimeout(a.PairableTimeout, step)
+		s.PairableTimeout = &d
+	}
+	return m, configureAdapterCmd(m.backend, m.timeouts, s)
+}
+
+// handleFilterKey edits the discovery filter. Applying it restarts a scan
+// in progress so BlueZ picks it up.
+func (m Model) handleFilterKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch key := msg.String(); {
+	case key == keyCtrlC:
+		return m, tea.Quit
+	case key == keyEsc:
+		m.filtering = false
+	case key == keyEnter:
+		filter, err := parseDiscoveryFilterLine(m.filterInput)
+		if err != nil {
+			m.statusText = err.Error()
+			return m, nil
+		}
+		m.scanFilter = filter
+		m.filtering = false
+		if m.scanning {
+			m.stopScan()
+			return m, m.startScan()
+		}
+	case key == keyBackspace:
+		if r := []rune(m.filterInput); len(r) > 0 {
+			m.filterInput = string(r[:len(r)-1])
+		}
+	case msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace:
+		m.filterInput += string(msg.Runes)
+	}
+	return m, nil
+}
+
+// handleRenameKey edits the selected device's new name. Saving an empty
+// name goes back to the one the device advertises.
+func (m Model) handleRenameKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch key := msg.String(); {
+	case key == keyCtrlC:
+		return m, tea.Quit
+	case key == keyEsc:
+		m.renaming, m.renameInput = "", ""
+	case key == keyEnter:
+		mac, alias := m.renaming, strings.TrimSpace(m.renameInput)
+		m.renaming, m.renameInput = "", ""
+		return m, setAliasCmd(m.backend, m.timeouts, mac, alias)
+	case key == keyBackspace:
+		if r := []rune(m.renameInput); len(r) > 0 {
+			m.renameInput = string(r[:len(r)-1])
+		}
+	case msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace:
+		if len(m.renameInput)+len(string(msg.Runes)) <= maxAliasLength {
+			m.renameInput += string(msg.Runes)
+		}
+	}
+	return m, nil
+}
+
+func (m Model) renameView() string {
+	d, _ := m.deviceByMAC(m.renaming)
+	var b strings.Builder
+	fmt.Fprintf(&b, "Rename %s\n\n", m.deviceLabel(m.renaming))
+	b.WriteString(passkeyStyle.Render("> "+m.renameInput+"_") + "\n\n")
+	if !bluezKeepsAlias(m.backend, d) {
+		why := "Not paired"
+		if d.Paired {
+			why = "The bluetoothctl backend can't rename devices"
+		}
+		b.WriteString(noDevicesStyle.Render(why+", so the name is only kept by hyprBluetooth.") + "\n\n")
+	}
+	restore := "Enter: Save (empty restores the advertised name)  Esc: Cancel"
+	if d.Name != "" {
+		restore = fmt.Sprintf("Enter: Save (empty restores %q)  Esc: Cancel", d.Name)
+	}
+	b.WriteString(noDevicesStyle.Render(restore))
+	return m.dialog(b.String())
+}
+
+func (m Model) filterView() string {
+	var b strings.Builder
+	b.WriteString("Discovery filter\n\n")
+	b.WriteString(passkeyStyle.Render("> "+m.filterInput+"_") + "\n\n")
+	b.WriteString(noDevicesStyle.Render("transport=auto|bredr|le  rssi=-70  pathloss=80  uuids=a2dp,hid\nduplicate-data=on|off  name=REGEX (rest of the line)") + "\n\n")
+	b.WriteString(noDevicesStyle.Render("Enter: Apply (empty clears)  Esc: Cancel"))
+	return m.dialog(b.String())
+}
+
+func (m Model) settingsView() string {
+	v := m.settings
+	var b strings.Builder
+	if v.adapter == nil {
+		b.WriteString("Adapter settings\n\n")
+		b.WriteString(noDevicesStyle.Render("Loading..."))
+		return m.dialog(b.String())
+	}
+	a := *v.adapter
+	fmt.Fprintf(&b, "Adapter settings for %s\n\n", a.MAC)
+	for i, key := range adapterSettingKeys {
+		var label, value string
+		switch key {
+		case "alias":
+			label, value = "Alias", a.Name
+			if v.editing {
+				value = v.input + "_"
+			}
+		case "discoverable":
+			label, value = "Discoverable", onOff(a.Discoverable)
+		case "discoverable-timeout":
+			label, value = "Discoverable timeout", formatTimeout(a.DiscoverableTimeout)
+		case "pairable":
+			label, value = "Pairable", onOff(a.Pairable)
+		case "pairable-timeout":
+			label, value = "Pairable timeout", formatTimeout(a.PairableTimeout)
+		}
+		cursor := " "
+		if i == v.cursor {
+			cursor = ">"
+		}
+		line := fmt.Sprintf("%s %-21s %s", cursor, label, value)
+		if i == v.cursor {
+			line = cursorRowStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	help := fmt.Sprintf("Enter/Space: Change  %s/%s: Timeout  Esc: Close", m.glyphs().left, m.glyphs().right)
+	if v.editing {
+		help = "Enter: Save alias  Esc: Cancel"
+	}
+	b.WriteString("\n" + noDevicesStyle.Render(help))
+	return m.dialog(b.String())
+}
+
+// detailView lists everything known about the selected device.
+func (m Model) detailView() string {
+	d, ok := m.selectedDevice()
+	if !ok {
+		return m.dialog(noDevicesStyle.Render("No device selected."))
+	}
+	var b strings.Builder
+	row := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%-15s %s\n", label+":", value)
+		}
+	}
+
+	name := d.DisplayName()
+	if name == "" {
+		name = "Unknown Device"
+	}
+	b.WriteString(passkeyStyle.Render(name) + "\n\n")
+	if d.HasAlias() {
+		row("Name", d.Name)
+	}
+	address := d.MAC
+	if d.AddressType != "" {
+		address += " (" + d.AddressType + ")"
+	}
+	row("Address", address)
+	row("Type", string(d.Category()))
+	if d.Class != 0 {
+		row("Class", fmt.Sprintf("0x%06x", d.Class))
+	}
+	if d.Appearance != 0 {
+		row("Appearance", fmt.Sprintf("0x%04x", d.Appearance))
+	}
+	row("Connected", yesNo(d.Connected))
+	row("Paired", yesNo(d.Paired))
+	row("Bonded", yesNo(d.Bonded))
+	row("Trusted", yesNo(d.Trusted))
+	row("Blocked", yesNo(d.Blocked))
+	row("Legacy pairing", yesNo(d.LegacyPairing))
+	row("Modalias", d.Modalias)
+	if d.HasBattery {
+		row("Battery", fmt.Sprintf("%d%%", d.Battery))
+	}
+	if d.HasRSSI {
+		row("RSSI", fmt.Sprintf("%d dBm", d.RSSI))
+	}
+	if d.HasTxPower {
+		row("TX power", fmt.Sprintf("%d dBm", d.TxPower))
+	}
+	if profiles := deviceProfiles(d); len(profiles) > 0 {
+		b.WriteString("\nServices:\n")
+		for _, p := range profiles {
+			if p.Short == "" {
+				fmt.Fprintf(&b, "  %s\n", p.UUID)
+				continue
+			}
+			fmt.Fprintf(&b, "  %-16s %s\n", p.Short, p.Name)
+		}
+	}
+	return m.dialog(strings.TrimSuffix(b.String(), "\n"))
+}
+
+func (m Model) handleBluetoothToggle() (tea.Model, tea.Cmd) {
+	if m.bluetoothChecked {
+		if m.bluetoothEnabled {
+			return m, disableBluetoothCmd(m.backend, m.timeouts, m.adapter)
+		}
+		return m, enableBluetoothCmd(m.backend, m.timeouts, m.adapter)
+	}
+	return m, nil
+}
+
+func (m Model) handlePairingRequestMsg(msg pairingRequestMsg) (tea.Model, tea.Cmd) {
+	next := waitForPairingRequestCmd(m.pairingRequests)
+	req := msg.request
+	if req.Kind == PairingCanceled {
+		m.closePairing()
+		m.statusText = "pairing canceled by device"
+		return m, next
+	}
+	// A display-only prompt for the same device just refreshes the modal.
+	if m.pairing != nil && m.pairing.NeedsReply() {
+		m.pairing.Reject()
+	}
+	m.pairing = req
+	m.pairingInput = ""
+	m.pairingSeq++
+	if !req.NeedsReply() {
+		return m, next
+	}
+	m.pairingDeadline = time.Now().Add(m.timeouts.Agent)
+	return m, tea.Batch(next, pairingTickCmd(m.pairingSeq))
+}
+
+func (m *Model) closePairing() {
+	m.pairing = nil
+	m.pairingInput = ""
+	m.pairingSeq++
+}
+
+func (m Model) handlePairingKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	req := m.pairing
+	switch key := msg.String(); {
+	case key == keyCtrlC:
+		req.Reject()
+		return m, tea.Quit
+
+	case !req.NeedsReply():
+		if key == keyEsc || key == keyEnter {
+			m.closePairing()
+		}
+
+	case req.NeedsInput():
+		return m.handlePairingInputKey(msg)
+
+	default:
+		return m.handlePairingConfirmKey(key)
+	}
+	return m, nil
+}
+
+// handlePairingInputKey edits the PIN code or passkey BlueZ asked for.
+func (m Model) handlePairingInputKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case keyEsc:
+		m.pairing.Reject()
+		m.closePairing()
+
+	case keyEnter:
+		if m.pairingInput == "" {
+			return m, nil
+		}
+		m.pairing.Accept(m.pairingInput)
+		m.closePairing()
+
+	case keyBackspace:
+		if n := len(m.pairingInput); n > 0 {
+			m.pairingInput = m.pairingInput[:n-1]
+		}
+
+	default:
+		if msg.Type == tea.KeyRunes {
+			m.pairingInput = appendPairingInput(m.pairing.Kind, m.pairingInput, msg.Runes)
+		}
+	}
+	return m, nil
+}
+
+// appendPairingInput adds the runes a request accepts: up to six digits
+// for a passkey, and up to 16 printable ASCII characters for a PIN code.
+func appendPairingInput(kind PairingRequestKind, input string, runes []rune) string {
+	for _, r := range runes {
+		if kind == PairingRequestPasskey && (r < '0' || r > '9' || len(input) >= 6) {
+			continue
+		}
+		if kind == PairingRequestPinCode && (r < ' ' || r > '~' || len(input) >= 16) {
+			continue
+		}
+		input += string(r)
+	}
+	return input
+}
+
+// handlePairingConfirmKey answers a yes/no request.
+func (m Model) handlePairingConfirmKey(key string) (tea.Model, tea.Cmd) {
+	switch key {
+	case "y", keyEnter:
+		m.pairing.Accept("")
+		m.closePairing()
+
+	case "n", keyEsc:
+		m.pairing.Reject()
+		m.closePairing()
+	}
+	return m, nil
+}
+
+func (m Model) deviceLabel(mac string) string {
+	for _, d := range m.devices {
+		if d.MAC == mac && d.DisplayName() != "" {
+			return fmt.Sprintf("%s (%s)", d.DisplayName(), mac)
+		}
+	}
+	return mac
+}
+
+func (m Model) pairingView() string {
+	req := m.pairing
+	device := m.deviceLabel(req.MAC)
+	passkey := passkeyStyle.Render(fmt.Sprintf("%06d", req.Passkey))
+
+	var body, keys string
+	switch req.Kind {
+	case PairingRequestPinCode:
+		body = fmt.Sprintf("Enter the PIN code for %s:\n\n> %s_", device, m.pairingInput)
+		keys = "Enter: Submit  Esc: Cancel"
+	case PairingRequestPasskey:
+		body = fmt.Sprintf("Enter the 6-digit passkey for %s:\n\n> %s_", device, m.pairingInput)
+		keys = "Enter: Submit  Esc: Cancel"
+	case PairingDisplayPinCode:
+		body = fmt.Sprintf("Type this PIN on %s:\n\n%s", device, passkeyStyle.Render(req.PinCode))
+		keys = "Esc: Dismiss"
+	case PairingDisplayPasskey:
+		body = fmt.Sprintf("Type this passkey on %s:\n\n%s  (%d typed)", device, passkey, req.Entered)
+		keys = "Esc: Dismiss"
+	case PairingConfirmation:
+		body = fmt.Sprintf("Does %s show this passkey?\n\n%s", device, passkey)
+		keys = "y/Enter: Confirm  n/Esc: Reject"
+	case PairingAuthorization:
+		body = fmt.Sprintf("Allow %s to pair?", device)
+		keys = "y/Enter: Allow  n/Esc: Reject"
+	case PairingAuthorizeService:
+		body = fmt.Sprintf("Allow %s to use service\n%s?", device, req.UUID)
+		keys = "y/Enter: Allow  n/Esc: Reject"
+	}
+
+	if req.NeedsReply() {
+		remaining := max(0, int(time.Until(m.pairingDeadline).Round(time.Second).Seconds()))
+		keys += fmt.Sprintf("  (%ds)", remaining)
+	}
+
+	return m.dialog("Pairing request\n\n" + body + "\n\n" + noDevicesStyle.Render(keys))
+}
+
+// modalOpen reports whether a dialog has taken over the keyboard, leaving
+// the list behind it alone.
+func (m Model) modalOpen() bool {
+	return m.pairing != nil || m.confirm != nil || m.profiles != nil || m.settings != nil || m.filtering || m.renaming != ""
+}
+
+func (m Model) handleMouseMsg(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	// The cursor must stay on the device a dialog is about.
+	if msg.Action != tea.MouseActionPress || m.modalOpen() {
+		return m, nil
+	}
+
+	switch msg.Button {
+	case tea.MouseButtonWheelUp:
+		m.moveCursor(-1)
+	case tea.MouseButtonWheelDown:
+		m.moveCursor(1)
+	case tea.MouseButtonLeft:
+		if m.details && m.width < detailSplitWidth {
+			return m, nil // the list isn't on screen
+		}
+		rows, start, end := m.viewport()
+		row := msg.Y - m.deviceListOffset()
+		if end-start < len(rows) {
+			row-- // the top scroll indicator
+		}
+		if row += start; row >= start && row < end && rows[row].device >= 0 {
+			m.cursor = rows[row].device
+		}
+	}
+	return m, nil
+}
+
+func (m Model) handleDeviceStatusMsg(msg deviceStatusMsg) (tea.Model, tea.Cmd) {
+	for i, device := range m.devices {
+		if device.MAC == msg.deviceMAC {
+			m.devices[i].Connected = msg.connected
+			break
+		}
+	}
+	m.sortDevices()
+	if m.events != nil {
+		return m, nil
+	}
+	return m, getDevicesCmd(m.backend, m.timeouts, m.adapter)
+}
+
+func (m Model) handleBluetoothStatusMsg(msg bluetoothStatusMsg) (tea.Model, tea.Cmd) {
+	if msg.adapter != m.adapter {
+		return m, nil
+	}
+	m.bluetoothChecked = true
+	if msg.err != nil {
+		m.statusText = msg.err.Error()
+		return m, nil
+	}
+	m.bluetoothEnabled = msg.enabled
+	m.statusText = ""
+	if msg.enabled && m.events == nil {
+		return m, getDevicesCmd(m.backend, m.timeouts, m.adapter)
+	}
+	return m, nil
+}
+
+// signalBar renders RSSI as four bars: roughly excellent, good, fair and
+// weak at -55, -67 and -80 dBm.
+func signalBar(d BluetoothDevice, g glyphSet) string {
+	bars := g.signal
+	level := 1
+	switch {
+	case d.RSSI >= -55:
+		level = 4
+	case d.RSSI >= -67:
+		level = 3
+	case d.RSSI >= -80:
+		level = 2
+	}
+	style := batteryHighStyle
+	switch level {
+	case 1:
+		style = batteryLowStyle
+	case 2:
+		style = batteryMidStyle
+	}
+	bar := style.Render(string([]rune(bars)[:level])) + strings.Repeat("_", 4-level)
+	line := fmt.Sprintf("%s %4d dBm", bar, d.RSSI)
+	if d.HasTxPower {
+		line += fmt.Sprintf(" (tx %d dBm)", d.TxPower)
+	}
+	return line
+}
+
+func (m Model) batteryGauge(pct int) string {
+	const cells = 5
+	filled := min(cells, max(0, (pct*cells+50)/100))
+	style := batteryHighStyle
+	switch {
+	case pct <= m.lowBattery:
+		style = batteryLowStyle
+	case pct <= 50:
+		style = batteryMidStyle
+	}
+	g := m.glyphs()
+	return style.Render(strings.Repeat(g.batteryFull, filled)+strings.Repeat(g.batteryEmpty, cells-filled)) + fmt.Sprintf(" %3d%%", pct)
+}
+
+// lowBatteryWarning names connected devices at or below the threshold.
+func (m Model) lowBatteryWarning() string {
+	var low []string
+	for _, d := range m.devices {
+		if d.Connected && d.HasBattery && d.Battery <= m.lowBattery {
+			name := d.DisplayName()
+			if name == "" {
+				name = d.MAC
+			}
+			low = append(low, fmt.Sprintf("%s %d%%", name, d.Battery))
+		}
+	}
+	if len(low) == 0 {
+		return ""
+	}
+	return decorate(m.glyphs().warning, "Low battery: "+strings.Join(low, ", "))
+}
+
+// deviceListView renders the rows in the viewport, highlighting what the
+// search matched, between scroll indicators when the list doesn't fit.
+func (m Model) deviceListView() string {
+	width := m.listWidth()
+	rows, start, end := m.viewport()
+	scrolled := end-start < len(rows)
+	lines := make([]string, 0, end-start+2)
+	if scrolled {
+		lines = append(lines, scrollIndicator(m.glyphs().scrollUp, start))
+	}
+	for _, row := range rows[start:end] {
+		if row.device < 0 {
+			lines = append(lines, groupHeaderStyle.Render(row.header))
+			continue
+		}
+		lines = append(lines, m.deviceRow(row.device, width))
+	}
+	if scrolled {
+		lines = append(lines, scrollIndicator(m.glyphs().scrollDown, len(rows)-end))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// deviceRow renders device i in no more than width cells, cutting the name
+// down first.
+func (m Model) deviceRow(i, width int) string {
+	g := m.glyphs()
+	device := m.devices[i]
+	cursor := " "
+	if m.cursor == i {
+		cursor = ">"
+	}
+
+	var glyph string
+	var style lipgloss.Style
+	switch {
+	case device.Blocked:
+		glyph, style = g.blocked, statusBlockedStyle
+	case device.Connected:
+		glyph, style = g.connected, statusConnectedStyle
+	case device.Paired:
+		glyph, style = g.paired, statusPairedStyle
+	default:
+		glyph, style = g.unpaired, statusUnpairedStyle
+	}
+
+	deviceName := device.DisplayName()
+	if deviceName == "" {
+		deviceName = "Unknown Device"
+	}
+
+	prefix := fmt.Sprintf("%s %s %s ", cursor, style.Render(glyph), categoryIcon(device.Category(), m.ascii))
+	mac := " (" + highlightMatch(device.MAC, m.search) + ")"
+	var extra string
+	if device.HasBattery {
+		extra += "  " + m.batteryGauge(device.Battery)
+	}
+	if m.scanning && device.HasRSSI {
+		extra += "  " + signalBar(device, g)
+	}
+	// The name gives way first, down to a few cells, then the extras.
+	room := width - lipgloss.Width(prefix+mac+extra)
+	if room < minNameWidth && extra != "" {
+		extra = ""
+		room = width - lipgloss.Width(prefix+mac)
+	}
+	name := truncateWidth(deviceName, max(room, minNameWidth), g.ellipsis)
+	line := truncateWidth(prefix+highlightMatch(name, m.search)+mac+extra, width, "")
+
+	if m.cursor == i {
+		line = cursorRowStyle.Render(line)
+	}
+	return line
+}
+
+// minNameWidth is the fewest cells a device name is cut down to.
+const minNameWidth = 8
+
+// listWidth is how wide the device list may draw: the window, less the
+// detail pane when it sits alongside.
+func (m Model) listWidth() int {
+	if m.details && m.width >= detailSplitWidth {
+		return max(m.width-lipgloss.Width(m.detailView())-2, 20)
+	}
+	return max(m.width, 20)
+}
+
+// scrollIndicator is blank when nothing is hidden on that side, so the
+// rows below it don't move.
+func scrollIndicator(arrow string, hidden int) string {
+	if hidden == 0 {
+		return ""
+	}
+	return scrollIndicatorStyle.Render(fmt.Sprintf("  %s %d more", arrow, hidden))
+}
+
+func (m Model) View() string {
+	var s strings.Builder
+	s.WriteString(m.headerView())
+	s.WriteString(m.bodyView())
+	s.WriteString("\n")
+	s.WriteString(m.footerView())
+	return s.String()
+}
+
+// headerView is everything above the device list: the title, adapter,
+// Bluetooth status, scan banner and search.
+func (m Model) headerView() string {
+	var s strings.Builder
+
+	// Every line is cut to the window: one that wrapped would shift the
+	// rows from where deviceListOffset puts them for the mouse.
+	line := func(text string) {
+		s.WriteString(truncateWidth(text, m.width, m.glyphs().ellipsis))
+		s.WriteString("\n")
+	}
+
+	line(titleStyle.Render("HyprBluetooth - Bluetooth Device Manager"))
+	if len(m.adapters) > 1 {
+		line(m.adapterView())
+	}
+	if m.bluetoothChecked {
+		line(m.bluetoothStatusView())
+	}
+	s.WriteString("\n")
+
+	if m.scanning {
+		line(scanStyle.Render(m.scanBanner()))
+		s.WriteString("\n")
+	}
+
+	if m.searching || m.search != "" {
+		line(m.searchView())
+	}
+	return s.String()
+}
+
+// bluetoothStatusView is the power state, with any low battery warning.
+func (m Model) bluetoothStatusView() string {
+	if !m.bluetoothEnabled {
+		return btOffStyle.Render(decorate(m.glyphs().bluetoothOff, "Bluetooth: OFF"))
+	}
+	status := btOnStyle.Render(decorate(m.glyphs().bluetoothOn, "Bluetooth: ON"))
+	if warning := m.lowBatteryWarning(); warning != "" {
+		status += "  " + warningStyle.Render(warning)
+	}
+	return status
+}
+
+// bodyView is the open dialog if there is one, else the device list or
+// why it is empty.
+func (m Model) bodyView() string {
+	if dialog := m.dialogView(); dialog != "" {
+		return dialog
+	}
+	switch {
+	case m.bluetoothChecked && !m.bluetoothEnabled:
+		return disabledStyle.Render(fmt.Sprintf("Bluetooth is disabled. Press '%s' to enable.", m.keys.key(actPower, m.glyphs())))
+	case len(m.devices) == 0:
+		return noDevicesStyle.Render(fmt.Sprintf("No devices found. Press '%s' to scan for devices.", m.keys.key(actScan, m.glyphs())))
+	case len(m.visibleDevices()) == 0:
+		return noDevicesStyle.Render(fmt.Sprintf("No devices match %q.", m.search))
+	}
+	switch list := m.deviceListView(); {
+	case m.details && m.width >= detailSplitWidth:
+		return lipgloss.JoinHorizontal(lipgloss.Top, list, "  ", m.detailView())
+	case m.details:
+		return m.detailView()
+	default:
+		return list
+	}
+}
+
+func (m Model) dialogView() string {
+	switch {
+	case m.pairing != nil:
+		return m.pairingView()
+	case m.confirm != nil:
+		return m.dialog(m.confirm.question + "\n\n" + noDevicesStyle.Render("y/Enter: Yes  n/Esc: No"))
+	case m.profiles != nil:
+		return m.profilesView()
+	case m.settings != nil:
+		return m.settingsView()
+	case m.filtering:
+		return m.filterView()
+	case m.renaming != "":
+		return m.renameView()
+	}
+	return ""
+}
+
+// footerView is the error line, if any, and the help.
+func (m Model) footerView() string {
+	var s strings.Builder
+	if m.statusText != "" {
+		s.WriteString(errorStyle.Render("Error: " + m.statusText))
+		s.WriteString("\n")
+	}
+
+	g := m.glyphs()
+	entries := m.keys.helpEntries(map[action]string{actSort: fmt.Sprintf("Sort (%s)", m.sortMode)}, g)
+	controls := "Controls:"
+	if m.pending != "" {
+		controls += "  " + displayKey(m.pending, g) + " " + g.ellipsis
+	}
+	help := "\n" + controls + "\n" + wrapEntries(entries, max(m.width, 40)) + "\n\n" +
+		fmt.Sprintf("Status: %s Connected  %s Paired  %s Unpaired  %s Blocked", g.connected, g.paired, g.unpaired, g.blocked)
 
 	s.WriteString(helpStyle.Render(help))
 
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+func testModel() Model {
+	m := initialModel(newFakeBackend())
+	m.devices = newFakeBackend().devices
+	m.bluetoothChecked, m.bluetoothEnabled = true, true
+	return m
+}
+
+func typeKeys(m Model, keys ...string) Model {
+	for _, k := range keys {
+		var msg tea.KeyMsg
+		switch k {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		default:
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		}
+		updated, _ := m.Update(msg)
+		m = updated.(Model)
+	}
+	return m
+}
+
+func click(m Model, y int) Model {
+	updated, _ := m.Update(tea.MouseMsg{Action: tea.MouseActionPress, Button: tea.MouseButtonLeft, Y: y})
+	return updated.(Model)
+}
+
+func TestSearchNarrowsList(t *testing.T) {
+	m := typeKeys(testModel(), "/", "m", "x")
+	if got := len(m.visibleDevices()); got != 2 {
+		t.Fatalf("visible = %d, want the two MX devices", got)
+	}
+	if d, ok := m.selectedDevice(); !ok || d.MAC != testMACMouse {
+		t.Errorf("cursor on %+v, want the first match", d)
+	}
+
+	// Keep the search, then click the second visible row.
+	m = typeKeys(m, "enter")
+	m = click(m, m.deviceListOffset()+1)
+	if d, _ := m.selectedDevice(); d.Name != "MX Keys" {
+		t.Errorf("clicked %q, want MX Keys", d.Name)
+	}
+	if m = click(m, m.deviceListOffset()+2); m.devices[m.cursor].Name != "MX Keys" {
+		t.Error("click below the filtered list moved the cursor")
+	}
+
+	m = typeKeys(m, "k")
+	if d, _ := m.selectedDevice(); d.Name != "MX Master 3" {
+		t.Errorf("up moved to %q, want MX Master 3", d.Name)
+	}
+
+	m = typeKeys(m, "esc")
+	if m.search != "" || len(m.visibleDevices()) != 3 {
+		t.Errorf("esc left search %q", m.search)
+	}
+}
+
+func TestGroupedListClick(t *testing.T) {
+	m := typeKeys(testModel(), "H")
+	rows := m.listRows()
+	var headers []string
+	for _, row := range rows {
+		if row.device < 0 {
+			headers = append(headers, row.header)
+		}
+	}
+	if want := []string{"Connected (1)", "Paired (1)", "Available (1)"}; !reflect.DeepEqual(headers, want) {
+		t.Fatalf("headers = %q, want %q", headers, want)
+	}
+
+	// Rows: Connected, WH-1000XM4, Paired, MX Master 3, Available, MX Keys.
+	if m = click(m, m.deviceListOffset()+3); m.devices[m.cursor].Name != "MX Master 3" {
+		t.Errorf("click on row 3 selected %q", m.devices[m.cursor].Name)
+	}
+	if m = click(m, m.deviceListOffset()+4); m.devices[m.cursor].Name != "MX Master 3" {
+		t.Errorf("click on a header moved the cursor to %q", m.devices[m.cursor].Name)
+	}
+}
+
+func TestViewportScrolls(t *testing.T) {
+	m := testModel()
+	m.devices = nil
+	for i := range 40 {
+		m.devices = append(m.devices, BluetoothDevice{MAC: fmt.Sprintf("00:00:00:00:00:%02X", i), Name: fmt.Sprintf("Device %d", i)})
+	}
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 24})
+	m = updated.(Model)
+
+	if got := lipgloss.Height(m.View()); got > m.height {
+		t.Fatalf("view is %d lines, window is %d", got, m.height)
+	}
+	m = typeKeys(m, "G")
+	if m.cursor != 39 {
+		t.Fatalf("G moved the cursor to %d", m.cursor)
+	}
+	view := m.View()
+	if !strings.Contains(view, "Device 39") || strings.Contains(view, "Device 0 ") || !strings.Contains(view, "more") {
+		t.Errorf("view after G doesn't show the end of the list:\n%s", view)
+	}
+
+	// The last row on screen sits just above the bottom indicator.
+	_, start, end := m.viewport()
+	if m = click(m, m.deviceListOffset()+end-start); m.cursor != 39 {
+		t.Errorf("click on the last visible row selected %d", m.cursor)
+	}
+	if m = click(m, m.deviceListOffset()+1); m.cursor != start {
+		t.Errorf("click on the first visible row selected %d, want %d", m.cursor, start)
+	}
+
+	m = typeKeys(m, "g")
+	if _, start, _ := m.viewport(); m.cursor != 0 || start != 0 {
+		t.Errorf("g left cursor %d, scroll %d", m.cursor, start)
+	}
+}
+
+func TestKeyChords(t *testing.T) {
+	m := testModel()
+	keys, err := newKeymap(map[string]keyList{"top": {"g g"}, "details": {"g i"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.keys = keys
+
+	m = typeKeys(m, "G")
+	if m.cursor != len(m.devices)-1 {
+		t.Fatalf("G moved the cursor to %d", m.cursor)
+	}
+	if m = typeKeys(m, "g"); m.pending != "g" || m.cursor != len(m.devices)-1 {
+		t.Fatalf("after g: pending %q, cursor %d", m.pending, m.cursor)
+	}
+	if m = typeKeys(m, "g"); m.pending != "" || m.cursor != 0 {
+		t.Errorf("g g left pending %q, cursor %d", m.pending, m.cursor)
+	}
+	if m = typeKeys(m, "g", "i"); !m.details {
+		t.Error("g i didn't open the details")
+	}
+	// A key that breaks off a chord still does its own job.
+	if m = typeKeys(m, "g", "j"); m.pending != "" || m.cursor != 1 {
+		t.Errorf("g j left pending %q, cursor %d", m.pending, m.cursor)
+	}
+
+	// The half-typed chord is shown, and dropped when a dialog opens.
+	m = typeKeys(m, "g")
+	if want := "Controls:  g " + m.glyphs().ellipsis; !strings.Contains(m.footerView(), want) {
+		t.Errorf("footer doesn't show %q:\n%s", want, m.footerView())
+	}
+	updated, _ := m.Update(pairingRequestMsg{request: &PairingRequest{Kind: PairingDisplayPasskey, MAC: testMACMouse, Passkey: 123456}})
+	if m = updated.(Model); m.pending != "" {
+		t.Errorf("pending %q survived the pairing prompt", m.pending)
+	}
+}
+
+func TestCtrlCAlwaysQuits(t *testing.T) {
+	m := testModel()
+	keys, err := newKeymap(map[string]keyList{"quit": {"Q"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.keys = keys
+	if _, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlC}); cmd == nil || cmd() != tea.Quit() {
+		t.Error("ctrl+c didn't quit after quit was rebound")
+	}
+}
+
+func TestDialogsFollowTheKeymap(t *testing.T) {
+	m := testModel()
+	keys, err := newKeymap(map[string]keyList{"up": {"w"}, "down": {"v"}, "adapter-settings": {"S"}, "quit": {"Q"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.keys = keys
+
+	m = typeKeys(m, "S", "v", "j")
+	if m.settings == nil || m.settings.cursor != 1 {
+		t.Fatalf("settings = %+v, want open on the second setting", m.settings)
+	}
+	if m = typeKeys(m, "w"); m.settings.cursor != 0 {
+		t.Errorf("cursor = %d after the rebound up key, want 0", m.settings.cursor)
+	}
+	if m = typeKeys(m, "A", "q"); m.settings == nil {
+		t.Error("unbound keys closed the settings")
+	}
+	if m = typeKeys(m, "S"); m.settings != nil {
+		t.Error("the settings key didn't close the settings")
+	}
+	if m = typeKeys(m, "S", "Q"); m.settings != nil {
+		t.Error("the quit key didn't close the settings")
+	}
+}
+
+func TestASCIIView(t *testing.T) {
+	m := testModel()
+	m.ascii = true
+	m.devices[0].HasBattery, m.devices[0].Battery = true, 10
+	m.devices = append(m.devices, BluetoothDevice{MAC: "33:44:55:66:77:88", Name: "Mystery", Blocked: true})
+	m = typeKeys(m, "s", "H")
+	m.devices[1].HasRSSI, m.devices[1].RSSI = true, -60
+
+	for _, view := range []string{m.View(), typeKeys(m, "A").View()} {
+		for _, r := range ansi.Strip(view) {
+			if r > unicode.MaxASCII {
+				t.Fatalf("ASCII view has %q:\n%s", r, view)
+			}
+		}
+	}
+}
+
+func TestDeviceRowsFitWidth(t *testing.T) {
+	m := testModel()
+	m.devices[0].Name = "A headset with a remarkably long name that will not fit"
+	m.devices[0].HasBattery, m.devices[0].Battery = true, 80
+	for _, width := range []int{30, 50, 80} {
+		for _, ascii := range []bool{false, true} {
+			m.width, m.ascii = width, ascii
+			for _, line := range strings.Split(m.deviceListView(), "\n") {
+				if w := lipgloss.Width(line); w > width {
+					t.Errorf("width %d, ascii %v: row is %d wide: %q", width, ascii, w, ansi.Strip(line))
+				}
+			}
+		}
+	}
+	m.width, m.ascii = 80, false
+	if list := ansi.Strip(m.deviceListView()); !strings.Contains(list, "A headset with") || !strings.Contains(list, "…") {
+		t.Errorf("long name wasn't shortened with an ellipsis:\n%s", list)
+	}
+
+	// So does the header above it, however much it has to say.
+	m.devices = append(m.devices, BluetoothDevice{MAC: "33:44:55:66:77:88", Name: "A keyboard whose battery is nearly flat", Connected: true, HasBattery: true, Battery: 5})
+	m.adapters = []Adapter{{MAC: "00:1A:7D:DA:71:13", Name: "The built-in controller of this laptop", Default: true}, {MAC: "5C:F3:70:8B:12:34"}}
+	m.adapter = "00:1A:7D:DA:71:13"
+	filter, err := parseDiscoveryFilter([]string{"transport=le", "rssi=-70", "uuids=a2dp,hfp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.scanFilter = filter
+	m = typeKeys(m, "s")
+	m.search = "headset"
+	for _, width := range []int{30, 50, 80} {
+		for _, ascii := range []bool{false, true} {
+			m.width, m.ascii = width, ascii
+			header := m.headerView()
+			// The mouse finds rows by counting the header's lines.
+			if n := strings.Count(header, "\n"); n != m.deviceListOffset() {
+				t.Errorf("width %d, ascii %v: header has %d lines, offset is %d", width, ascii, n, m.deviceListOffset())
+			}
+			for _, line := range strings.Split(header, "\n") {
+				if w := lipgloss.Width(line); w > width {
+					t.Errorf("width %d, ascii %v: header line is %d wide: %q", width, ascii, w, ansi.Strip(line))
+				}
+			}
+		}
+	}
+}
+
+func TestRenamePrompt(t *testing.T) {
+	m := typeKeys(testModel(), "n")
+	if m.renaming != testMACHeadphones || m.renameInput != "WH-1000XM4" {
+		t.Fatalf("renaming %q with %q, want the headphones' name to edit", m.renaming, m.renameInput)
+	}
+	if view := m.View(); !strings.Contains(view, "Rename WH-1000XM4") || strings.Contains(view, "only kept by hyprBluetooth") {
+		t.Errorf("view has no rename prompt, or says a paired device's name stays local:\n%s", view)
+	}
+	// bluetoothctl can't rename in BlueZ, paired or not.
+	ctl := m
+	ctl.backend = withAliases(bluetoothctlBackend{}, nil)
+	if view := ctl.View(); !strings.Contains(view, "only kept by hyprBluetooth") {
+		t.Errorf("view doesn't say the name stays local on bluetoothctl:\n%s", view)
+	}
+	if m = typeKeys(m, "esc"); m.renaming != "" {
+		t.Fatal("esc left the prompt open")
+	}
+
+	m = typeKeys(m, "n")
+	m.renameInput = ""
+	m = typeKeys(m, "Cans ")
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if updated.(Model).renaming != "" || cmd == nil {
+		t.Fatal("enter didn't save the name")
+	}
+	cmd()
+	b := m.backend.(*fakeBackend)
+	if want := "set-alias " + testMACHeadphones + " Cans"; strings.Join(b.calls, ",") != want {
+		t.Errorf("calls = %v, want [%s]", b.calls, want)
+	}
+}
+
+func TestMouseIgnoredBehindModal(t *testing.T) {
+	m := typeKeys(testModel(), "x") // confirm removing the headphones
+	updated, _ := m.Update(tea.MouseMsg{Action: tea.MouseActionPress, Button: tea.MouseButtonWheelDown})
+	m = updated.(Model)
+	m = click(m, m.deviceListOffset()+2)
+	if m.cursor != 0 {
+		t.Errorf("cursor moved to %d behind the confirm dialog", m.cursor)
+	}
+}
+
+func TestAdapterSwitchDropsStaleResults(t *testing.T) {
+	m := testModel()
+	m.adapters = []Adapter{{MAC: "00:1A:7D:DA:71:13", Default: true}, {MAC: "5C:F3:70:8B:12:34"}}
+	old := m.adapter
+	m = typeKeys(m, "a")
+	if m.adapter != "5C:F3:70:8B:12:34" {
+		t.Fatalf("adapter = %q after switching", m.adapter)
+	}
+
+	updated, _ := m.Update(devicesMsg{adapter: old, devices: newFakeBackend().devices})
+	updated, _ = updated.(Model).Update(bluetoothStatusMsg{adapter: old, enabled: true})
+	canceled := false
+	updated, _ = updated.(Model).Update(eventsSubscribedMsg{adapter: old, events: make(chan Event), cancel: func() { canceled = true }})
+	m = updated.(Model)
+	if len(m.devices) != 0 || m.bluetoothChecked || m.events != nil {
+		t.Errorf("the old adapter's results were applied: %d devices, checked %v, events %v", len(m.devices), m.bluetoothChecked, m.events != nil)
+	}
+	if !canceled {
+		t.Error("the old adapter's event subscription wasn't canceled")
+	}
+
+	updated, _ = m.Update(devicesMsg{adapter: m.adapter, devices: newFakeBackend().devices[:1]})
+	if got := len(updated.(Model).devices); got != 1 {
+		t.Errorf("got %d devices from the new adapter, want 1", got)
+	}
+}
+
+func TestAdapterSwitchSkipsUnreachableAdapters(t *testing.T) {
+	m := testModel()
+	m.backend = bluetoothctlBackend{}
+	m.adapters = []Adapter{{MAC: "00:1A:7D:DA:71:13", Default: true}, {MAC: "5C:F3:70:8B:12:34"}}
+	m.adapter = "00:1A:7D:DA:71:13"
+	m = typeKeys(m, "a")
+	if m.adapter != "00:1A:7D:DA:71:13" {
+		t.Errorf("switched to %q, which bluetoothctl can't reach", m.adapter)
+	}
+	if m.statusText != errAdapterUnreachable.Error() {
+		t.Errorf("status = %q, want %q", m.statusText, errAdapterUnreachable)
+	}
+}
+
+func TestStatePrunesLastSeen(t *testing.T) {
+	m := testModel()
+	now := time.Now()
+	old := now.Add(-2 * lastSeenMaxAge)
+	m.lastSeen = map[string]time.Time{
+		testMACMouse:        old,                 // listed, kept however old
+		"AA:BB:CC:DD:EE:01": now.Add(-time.Hour), // recently heard
+		"AA:BB:CC:DD:EE:02": old,                 // long gone
+	}
+	s := m.state()
+	want := []string{testMACMouse, "AA:BB:CC:DD:EE:01"}
+	if got := slices.Sorted(maps.Keys(s.LastSeen)); !reflect.DeepEqual(got, want) {
+		t.Errorf("saved last-seen for %v, want %v", got, want)
+	}
+
+	// The saved map is written from another goroutine, so it must be a copy.
+	m.markSeen(BluetoothDevice{MAC: "AA:BB:CC:DD:EE:03", Connected: true})
+	if _, ok := s.LastSeen["AA:BB:CC:DD:EE:03"]; ok {
+		t.Error("state() shares lastSeen with the model")
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	formatPlain = "plain"
+	formatJSON  = "json"
+	formatTSV   = "tsv"
+
+	// outputSchemaVersion is bumped whenever a JSON field is renamed or
+	// removed. Adding fields does not change it.
+	outputSchemaVersion = 1
+)
+
+type deviceJSON struct {
+	MAC       string `json:"mac"`
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+	Paired    bool   `json:"paired"`
+	Trusted   bool   `json:"trusted"`
+	Blocked   bool   `json:"blocked"`
+	// Category is one of the DeviceCategory names, "unknown" if unclear.
+	Category string `json:"category"`
+	// Battery, RSSI and TxPower are null when the device doesn't report
+	// them; RSSI and TxPower are in dBm and only present during discovery.
+	Battery *int `json:"battery"`
+	RSSI    *int `json:"rssi"`
+	TxPower *int `json:"tx_power"`
+	// UUIDs are the advertised services, always an array.
+	UUIDs []string `json:"uuids"`
+	// Alias is the name the user gave the device, empty if none; Name is
+	// what the device advertises.
+	Alias string `json:"alias"`
+}
+
+type profileJSON struct {
+	UUID  string `json:"uuid"`
+	Name  string `json:"name"`
+	Short string `json:"short"`
+}
+
+type profilesJSON struct {
+	SchemaVersion int           `json:"schema_version"`
+	Profiles      []profileJSON `json:"profiles"`
+}
+
+type adapterJSON struct {
+	Powered bool `json:"powered"`
+}
+
+type adapterInfoJSON struct {
+	MAC          string `json:"mac"`
+	Name         string `json:"name"`
+	Powered      bool   `json:"powered"`
+	Default      bool   `json:"default"`
+	Discoverable bool   `json:"discoverable"`
+	Pairable     bool   `json:"pairable"`
+	// The timeouts are in seconds, 0 for none.
+	DiscoverableTimeout int `json:"discoverable_timeout"`
+	PairableTimeout     int `json:"pairable_timeout"`
+}
+
+type adapterDetailJSON struct {
+	SchemaVersion int             `json:"schema_version"`
+	Adapter       adapterInfoJSON `json:"adapter"`
+}
+
+type adaptersJSON struct {
+	SchemaVersion int               `json:"schema_version"`
+	Adapters      []adapterInfoJSON `json:"adapters"`
+}
+
+type listJSON struct {
+	SchemaVersion int          `json:"schema_version"`
+	Devices       []deviceJSON `json:"devices"`
+}
+
+type statusJSON struct {
+	SchemaVersion int          `json:"schema_version"`
+	Adapter       adapterJSON  `json:"adapter"`
+	Connected     []deviceJSON `json:"connected"`
+}
+
+func toDeviceJSON(devices []BluetoothDevice) []deviceJSON {
+	out := make([]deviceJSON, 0, len(devices))
+	for _, d := range devices {
+		out = append(out, deviceJSON{
+			MAC:       d.MAC,
+			Name:      d.Name,
+			Alias:     aliasField(d),
+			Connected: d.Connected,
+			Paired:    d.Paired,
+			Trusted:   d.Trusted,
+			Blocked:   d.Blocked,
+			Category:  string(d.Category()),
+			Battery:   optionalInt(d.Battery, d.HasBattery),
+			RSSI:      optionalInt(d.RSSI, d.HasRSSI),
+			TxPower:   optionalInt(d.TxPower, d.HasTxPower),
+			UUIDs:     append([]string{}, d.UUIDs...),
+		})
+	}
+	return out
+}
+
+// aliasField is the device's alias, or empty when it just repeats the name.
+func aliasField(d BluetoothDevice) string {
+	if d.HasAlias() {
+		return d.Alias
+	}
+	return ""
+}
+
+func optionalInt(v int, ok bool) *int {
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+func parseFormat(format string, asJSON bool) (string, error) {
+	if asJSON {
+		if format != "" && format != formatJSON {
+			return "", usageError("--json conflicts with --format=%s", format)
+		}
+		return formatJSON, nil
+	}
+	switch format {
+	case "":
+		return formatPlain, nil
+	case formatPlain, formatJSON, formatTSV:
+		return format, nil
+	}
+	return "", usageError("unknown format %q (want %s, %s or %s)", format, formatPlain, formatJSON, formatTSV)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	return enc.Encode(v)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return bluetoothYes
+	}
+	return "no"
+}
+
+// tsvField keeps a value on one TSV cell.
+func tsvField(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ").Replace(s)
+}
+
+func writeDeviceTSV(w io.Writer, devices []BluetoothDevice) {
+	for _, d := range devices {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.MAC, tsvField(d.Name), yesNo(d.Connected), yesNo(d.Paired), yesNo(d.Trusted), yesNo(d.Blocked),
+			numberField(d.Battery, d.HasBattery), numberField(d.RSSI, d.HasRSSI), numberField(d.TxPower, d.HasTxPower),
+			d.Category(), tsvField(aliasField(d)))
+	}
+}
+
+// numberField is the value, or empty when not reported.
+func numberField(v int, ok bool) string {
+	if !ok {
+		return ""
+	}
+	return strconv.Itoa(v)
+}
+
+func writeDevicePlain(w io.Writer, devices []BluetoothDevice) {
+	for _, d := range devices {
+		line := fmt.Sprintf("%s  %-9s  %s", d.MAC, deviceState(d), d.DisplayName())
+		if d.HasBattery {
+			line += fmt.Sprintf(" (%d%%)", d.Battery)
+		}
+		if d.HasRSSI {
+			line += fmt.Sprintf("  %d dBm", d.RSSI)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+func writeDeviceList(w io.Writer, format string, devices []BluetoothDevice) error {
+	switch format {
+	case formatJSON:
+		return writeJSON(w, listJSON{SchemaVersion: outputSchemaVersion, Devices: toDeviceJSON(devices)})
+	case formatTSV:
+		writeDeviceTSV(w, devices)
+	default:
+		writeDevicePlain(w, devices)
+	}
+	return nil
+}
+
+func writeStatus(w io.Writer, format string, powered bool, devices []BluetoothDevice) error {
+	var connected []BluetoothDevice
+	for _, d := range devices {
+		if d.Connected {
+			connected = append(connected, d)
+		}
+	}
+
+	switch format {
+	case formatJSON:
+		return writeJSON(w, statusJSON{
+			SchemaVersion: outputSchemaVersion,
+			Adapter:       adapterJSON{Powered: powered},
+			Connected:     toDeviceJSON(connected),
+		})
+	case formatTSV:
+		fmt.Fprintf(w, "powered\t%s\n", yesNo(powered))
+		writeDeviceTSV(w, connected)
+	default:
+		fmt.Fprintf(w, "Bluetooth: %s\n", onOff(powered))
+		for _, d := range connected {
+			if d.HasBattery {
+				fmt.Fprintf(w, "Connected: %s (%s) %d%%\n", d.DisplayName(), d.MAC, d.Battery)
+				continue
+			}
+			fmt.Fprintf(w, "Connected: %s (%s)\n", d.DisplayName(), d.MAC)
+		}
+	}
+	return nil
+}
+
+func writeProfiles(w io.Writer, format string, profiles []Profile) error {
+	switch format {
+	case formatJSON:
+		out := profilesJSON{SchemaVersion: outputSchemaVersion, Profiles: make([]profileJSON, 0, len(profiles))}
+		for _, p := range profiles {
+			out.Profiles = append(out.Profiles, profileJSON{UUID: p.UUID, Name: p.Name, Short: p.Short})
+		}
+		return writeJSON(w, out)
+	case formatTSV:
+		for _, p := range profiles {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", p.UUID, p.Short, tsvField(p.Name))
+		}
+	default:
+		for _, p := range profiles {
+			if p.Name == p.UUID {
+				fmt.Fprintf(w, "%-16s %s\n", "", p.UUID)
+				continue
+			}
+			fmt.Fprintf(w, "%-16s %-30s %s\n", p.Short, p.Name, p.UUID)
+		}
+	}
+	return nil
+}
+
+func writeAdapters(w io.Writer, format string, adapters []Adapter) error {
+	switch format {
+	case formatJSON:
+		out := adaptersJSON{SchemaVersion: outputSchemaVersion, Adapters: make([]adapterInfoJSON, 0, len(adapters))}
+		for _, a := range adapters {
+			out.Adapters = append(out.Adapters, toAdapterInfoJSON(a))
+		}
+		return writeJSON(w, out)
+	case formatTSV:
+		for _, a := range adapters {
+			writeAdapterTSV(w, a)
+		}
+	default:
+		for _, a := range adapters {
+			line := fmt.Sprintf("%s  %-3s  %s", a.MAC, onOff(a.Powered), a.Name)
+			if a.Default {
+				line += " [default]"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	return nil
+}
+
+func toAdapterInfoJSON(a Adapter) adapterInfoJSON {
+	return adapterInfoJSON{
+		MAC:                 a.MAC,
+		Name:                a.Name,
+		Powered:             a.Powered,
+		Default:             a.Default,
+		Discoverable:        a.Discoverable,
+		Pairable:            a.Pairable,
+		DiscoverableTimeout: int(a.DiscoverableTimeout / time.Second),
+		PairableTimeout:     int(a.PairableTimeout / time.Second),
+	}
+}
+
+// writeAdapterTSV writes mac, name, powered, default, discoverable,
+// pairable and the two timeouts in seconds.
+func writeAdapterTSV(w io.Writer, a Adapter) {
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", a.MAC, tsvField(a.Name), yesNo(a.Powered), yesNo(a.Default),
+		yesNo(a.Discoverable), yesNo(a.Pairable), a.DiscoverableTimeout/time.Second, a.PairableTimeout/time.Second)
+}
+
+// writeAdapter shows one adapter's settings, for `adapter show`.
+func writeAdapter(w io.Writer, format string, a Adapter) error {
+	switch format {
+	case formatJSON:
+		return writeJSON(w, adapterDetailJSON{SchemaVersion: outputSchemaVersion, Adapter: toAdapterInfoJSON(a)})
+	case formatTSV:
+		writeAdapterTSV(w, a)
+	default:
+		fmt.Fprintf(w, "Adapter:              %s\n", a.MAC)
+		fmt.Fprintf(w, "Alias:                %s\n", a.Name)
+		fmt.Fprintf(w, "Powered:              %s\n", onOff(a.Powered))
+		fmt.Fprintf(w, "Discoverable:         %s\n", onOff(a.Discoverable))
+		fmt.Fprintf(w, "Discoverable timeout: %s\n", formatTimeout(a.DiscoverableTimeout))
+		fmt.Fprintf(w, "Pairable:             %s\n", onOff(a.Pairable))
+		fmt.Fprintf(w, "Pairable timeout:     %s\n", formatTimeout(a.PairableTimeout))
+	}
+	return nil
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
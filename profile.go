@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// bluetoothBaseUUID is the suffix shared by every 16-bit assigned number.
+const bluetoothBaseUUID = "-0000-1000-8000-00805f9b34fb"
+
+// Profile is a service a device advertises, identified by its UUID.
+type Profile struct {
+	UUID string
+	Name string
+	// Short is the common abbreviation, e.g. "A2DP", accepted wherever a
+	// profile is named on the command line. Empty for unknown services.
+	Short string
+}
+
+// knownProfiles lists the services worth naming, keyed by 16-bit UUID.
+var knownProfiles = map[string]Profile{
+	"1101": {Name: "Serial Port", Short: "SPP"},
+	"1105": {Name: "OBEX Object Push", Short: "OPP"},
+	"1106": {Name: "OBEX File Transfer", Short: "FTP"},
+	"1108": {Name: "Headset", Short: "HSP"},
+	"110a": {Name: "Audio Source", Short: "A2DP-Source"},
+	"110b": {Name: "Audio Sink", Short: "A2DP"},
+	"110c": {Name: "A/V Remote Control Target", Short: "AVRCP-Target"},
+	"110e": {Name: "A/V Remote Control", Short: "AVRCP"},
+	"110f": {Name: "A/V Remote Control Controller", Short: "AVRCP-Controller"},
+	"1112": {Name: "Headset Audio Gateway", Short: "HSP-AG"},
+	"1115": {Name: "PAN User", Short: "PANU"},
+	"1116": {Name: "Network Access Point", Short: "NAP"},
+	"1117": {Name: "Group Network", Short: "GN"},
+	"111e": {Name: "Handsfree", Short: "HFP"},
+	"111f": {Name: "Handsfree Audio Gateway", Short: "HFP-AG"},
+	"1124": {Name: "Human Interface Device", Short: "HID"},
+	"112f": {Name: "Phonebook Access Server", Short: "PBAP"},
+	"1132": {Name: "Message Access Server", Short: "MAP"},
+	"1200": {Name: "PnP Information", Short: "DID"},
+	"1800": {Name: "Generic Access", Short: "GAP"},
+	"1801": {Name: "Generic Attribute", Short: "GATT"},
+	"180a": {Name: "Device Information", Short: "DIS"},
+	"180f": {Name: "Battery Service", Short: "BAS"},
+	"1812": {Name: "HID over GATT", Short: "HOGP"},
+	"184e": {Name: "Audio Stream Control", Short: "ASCS"},
+	"1850": {Name: "Published Audio Capabilities", Short: "PACS"},
+}
+
+// shortUUID returns the 16-bit form of uuid if it is built on the Bluetooth
+// base UUID.
+func shortUUID(uuid string) (string, bool) {
+	uuid = strings.ToLower(uuid)
+	if len(uuid) != 36 || !strings.HasPrefix(uuid, "0000") || !strings.HasSuffix(uuid, bluetoothBaseUUID) {
+		return "", false
+	}
+	return uuid[4:8], true
+}
+
+// lookupProfile names uuid, falling back to the bare UUID.
+func lookupProfile(uuid string) Profile {
+	uuid = strings.ToLower(uuid)
+	if short, ok := shortUUID(uuid); ok {
+		if p, ok := knownProfiles[short]; ok {
+			p.UUID = uuid
+			return p
+		}
+	}
+	return Profile{UUID: uuid, Name: uuid}
+}
+
+// deviceProfiles lists the device's services in the order BlueZ reported.
+func deviceProfiles(d BluetoothDevice) []Profile {
+	profiles := make([]Profile, 0, len(d.UUIDs))
+	for _, uuid := range d.UUIDs {
+		profiles = append(profiles, lookupProfile(uuid))
+	}
+	return profiles
+}
+
+var uuidRegex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// resolveProfile turns a full UUID, a 16-bit UUID ("110b") or an
+// abbreviation ("a2dp") into a full UUID.
+func resolveProfile(query string) (string, error) {
+	q := strings.ToLower(query)
+	if uuidRegex.MatchString(q) {
+		return q, nil
+	}
+	if len(q) == 36 {
+		return "", fmt.Errorf("invalid UUID %q", query)
+	}
+	if _, ok := knownProfiles[q]; ok {
+		return "0000" + q + bluetoothBaseUUID, nil
+	}
+	for short, p := range knownProfiles {
+		if strings.EqualFold(p.Short, q) {
+			return "0000" + short + bluetoothBaseUUID, nil
+		}
+	}
+	return "", fmt.Errorf("unknown profile %q", query)
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+const (
+	testUUIDA2DP = "0000110b-0000-1000-8000-00805f9b34fb"
+	testUUIDHFP  = "0000111e-0000-1000-8000-00805f9b34fb"
+)
+
+func TestLookupProfile(t *testing.T) {
+	if p := lookupProfile("0000110B-0000-1000-8000-00805F9B34FB"); p.Short != "A2DP" || p.UUID != testUUIDA2DP {
+		t.Errorf("got %+v, want A2DP", p)
+	}
+	vendor := "f8d1fbe4-7966-4334-8024-ff96c9330e15"
+	if p := lookupProfile(vendor); p.Name != vendor || p.Short != "" {
+		t.Errorf("got %+v, want the bare UUID", p)
+	}
+}
+
+func TestResolveProfile(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{"a2dp", testUUIDA2DP, false},
+		{"HFP", testUUIDHFP, false},
+		{"110b", testUUIDA2DP, false},
+		{testUUIDHFP, testUUIDHFP, false},
+		{"music", "", true},
+		{"0000110b-0000-1000-8000-00805f9b34fz", "", true},
+		{"this-is-thirty-six-characters-long!!", "", true},
+	}
+	for _, tc := range tests {
+		got, err := resolveProfile(tc.query)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("resolveProfile(%q) = %q, %v; want %q", tc.query, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseDeviceInfoUUIDs(t *testing.T) {
+	input := `Device AA:BB:CC:DD:EE:FF (public)
+	Name: WH-1000XM4
+	UUID: Audio Sink                (0000110b-0000-1000-8000-00805f9b34fb)
+	UUID: Handsfree                 (0000111e-0000-1000-8000-00805f9b34fb)
+`
+	d := parseDeviceInfo([]byte(input), testMACHeadphones)
+	profiles := deviceProfiles(d)
+	if len(profiles) != 2 || profiles[0].Short != "A2DP" || profiles[1].Short != "HFP" {
+		t.Errorf("got %+v, want A2DP and HFP", profiles)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var searchMatchStyle lipgloss.Style
+
+// deviceMatches reports whether query is a case-insensitive fragment of
+// the device's name, alias or MAC address. The MAC also matches without
+// colons, so "eeff" finds AA:BB:CC:DD:EE:FF.
+func deviceMatches(d BluetoothDevice, query string) bool {
+	if query == "" {
+		return true
+	}
+	q := strings.ToLower(query)
+	mac := strings.ToLower(d.MAC)
+	return strings.Contains(strings.ToLower(d.Name), q) ||
+		strings.Contains(strings.ToLower(d.Alias), q) ||
+		strings.Contains(mac, q) ||
+		strings.Contains(strings.ReplaceAll(mac, ":", ""), strings.ReplaceAll(q, ":", ""))
+}
+
+// highlightMatch renders the first case-insensitive occurrence of query in
+// s with searchMatchStyle.
+func highlightMatch(s, query string) string {
+	if query == "" {
+		return s
+	}
+	// ToLower can change byte lengths outside ASCII, so only trust the
+	// index when it doesn't.
+	lower, q := strings.ToLower(s), strings.ToLower(query)
+	i := strings.Index(lower, q)
+	if i < 0 || len(lower) != len(s) {
+		return s
+	}
+	end := i + len(q)
+	return s[:i] + searchMatchStyle.Render(s[i:end]) + s[end:]
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeviceMatches(t *testing.T) {
+	d := BluetoothDevice{MAC: testMACHeadphones, Name: "WH-1000XM4", Alias: "Office headphones"}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"1000x", true},
+		{"office", true},
+		{"dd:ee", true},
+		{"ddeeff", true},
+		{"mouse", false},
+	}
+	for _, tc := range tests {
+		if got := deviceMatches(d, tc.query); got != tc.want {
+			t.Errorf("deviceMatches(%q) = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestHighlightMatch(t *testing.T) {
+	got := highlightMatch("MX Master 3", "master")
+	if !strings.HasPrefix(got, "MX ") || !strings.HasSuffix(got, " 3") || !strings.Contains(got, "Master") {
+		t.Errorf("highlightMatch = %q", got)
+	}
+	if got := highlightMatch("MX Master 3", "keys"); got != "MX Master 3" {
+		t.Errorf("no match changed the text: %q", got)
+	}
+}
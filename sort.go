@@ -0,0 +1,111 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// sortMode is how the device list is ordered.
+type sortMode string
+
+const (
+	// sortDefault keeps the order the backend lists devices in.
+	sortDefault   sortMode = "default"
+	sortConnected sortMode = "connected"
+	sortPaired    sortMode = "paired"
+	sortName      sortMode = "name"
+	sortLastSeen  sortMode = "last-seen"
+	sortSignal    sortMode = "signal"
+)
+
+// sortModes is the order 'o' cycles through.
+var sortModes = []sortMode{sortDefault, sortConnected, sortPaired, sortName, sortLastSeen, sortSignal}
+
+func parseSortMode(s string) (sortMode, bool) {
+	for _, mode := range sortModes {
+		if string(mode) == s {
+			return mode, true
+		}
+	}
+	return sortDefault, false
+}
+
+func (s sortMode) next() sortMode {
+	for i, mode := range sortModes {
+		if mode == s {
+			return sortModes[(i+1)%len(sortModes)]
+		}
+	}
+	return sortDefault
+}
+
+// deviceGroup is the section a device is listed under when grouping.
+type deviceGroup int
+
+const (
+	groupConnected deviceGroup = iota
+	groupPaired
+	groupAvailable
+)
+
+var deviceGroupTitles = map[deviceGroup]string{
+	groupConnected: "Connected",
+	groupPaired:    "Paired",
+	groupAvailable: "Available",
+}
+
+func groupOf(d BluetoothDevice) deviceGroup {
+	switch {
+	case d.Connected:
+		return groupConnected
+	case d.Paired:
+		return groupPaired
+	}
+	return groupAvailable
+}
+
+// sortDeviceList orders devices by mode, sections first when grouped.
+// Sorting is stable, so ties keep the backend's order. lastSeen is only
+// consulted for sortLastSeen.
+func sortDeviceList(devices []BluetoothDevice, mode sortMode, grouped bool, lastSeen map[string]time.Time) {
+	less := deviceLess(mode, lastSeen)
+	sort.SliceStable(devices, func(i, j int) bool {
+		a, b := devices[i], devices[j]
+		if grouped {
+			if ga, gb := groupOf(a), groupOf(b); ga != gb {
+				return ga < gb
+			}
+		}
+		return less != nil && less(a, b)
+	})
+}
+
+func deviceLess(mode sortMode, lastSeen map[string]time.Time) func(a, b BluetoothDevice) bool {
+	switch mode {
+	case sortConnected:
+		return func(a, b BluetoothDevice) bool { return groupOf(a) < groupOf(b) }
+	case sortPaired:
+		return func(a, b BluetoothDevice) bool { return a.Paired && !b.Paired }
+	case sortName:
+		// Unnamed devices go last.
+		return func(a, b BluetoothDevice) bool {
+			an, bn := a.DisplayName(), b.DisplayName()
+			if (an == "") != (bn == "") {
+				return bn == ""
+			}
+			return strings.ToLower(an) < strings.ToLower(bn)
+		}
+	case sortLastSeen:
+		return func(a, b BluetoothDevice) bool { return lastSeen[a.MAC].After(lastSeen[b.MAC]) }
+	case sortSignal:
+		// Devices without a reading go after those with one.
+		return func(a, b BluetoothDevice) bool {
+			if a.HasRSSI != b.HasRSSI {
+				return a.HasRSSI
+			}
+			return a.RSSI > b.RSSI
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSortDeviceList(t *testing.T) {
+	now := time.Now()
+	devices := []BluetoothDevice{
+		{MAC: "A", Name: "keyboard", HasRSSI: true, RSSI: -80},
+		{MAC: "B", Name: "", Paired: true},
+		{MAC: "C", Name: "Speaker", Connected: true, Paired: true, HasRSSI: true, RSSI: -50},
+		{MAC: "D", Name: "mouse", Paired: true, HasRSSI: true, RSSI: -60},
+	}
+	lastSeen := map[string]time.Time{"A": now, "D": now.Add(-time.Hour), "C": now.Add(-time.Minute)}
+	tests := []struct {
+		mode    sortMode
+		grouped bool
+		want    string
+	}{
+		{sortDefault, false, "ABCD"},
+		{sortConnected, false, "CBDA"},
+		{sortPaired, false, "BCDA"},
+		{sortName, false, "ADCB"},
+		{sortLastSeen, false, "ACDB"},
+		{sortSignal, false, "CDAB"},
+		{sortDefault, true, "CBDA"},
+		{sortName, true, "CDBA"},
+		{sortSignal, true, "CDBA"},
+	}
+	for _, tc := range tests {
+		list := append([]BluetoothDevice(nil), devices...)
+		sortDeviceList(list, tc.mode, tc.grouped, lastSeen)
+		var got string
+		for _, d := range list {
+			got += d.MAC
+		}
+		if got != tc.want {
+			t.Errorf("sortDeviceList(%s, grouped=%v) = %s, want %s", tc.mode, tc.grouped, got, tc.want)
+		}
+	}
+}
+
+func TestSortModeNext(t *testing.T) {
+	mode := sortDefault
+	for range sortModes {
+		mode = mode.next()
+	}
+	if mode != sortDefault {
+		t.Errorf("cycling every mode ended on %s", mode)
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hyprBluetooth", "state.json")
+	if s, err := loadState(path); err != nil || s.Sort != sortDefault {
+		t.Fatalf("loadState(missing) = %+v, %v", s, err)
+	}
+	want := uiState{
+		Sort:     sortName,
+		Grouped:  true,
+		LastSeen: map[string]time.Time{testMACMouse: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+	if err := saveState(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadState = %+v, want %+v", got, want)
+	}
+}
+
+func TestStateFileIsPrivate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hyprBluetooth")
+	path := filepath.Join(dir, "state.json")
+	for range 2 {
+		if err := saveState(path, uiState{Sort: sortName}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("state file mode = %v, want 0600", perm)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d entries, want only the state file", len(entries))
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// uiState is what the TUI remembers between runs.
+type uiState struct {
+	Sort    sortMode `json:"sort,omitempty"`
+	Grouped bool     `json:"grouped,omitempty"`
+	// LastSeen is when each device was last connected or heard during a
+	// scan, for the last-seen sort.
+	LastSeen map[string]time.Time `json:"last_seen,omitempty"`
+}
+
+// defaultStatePath is $XDG_STATE_HOME/hyprBluetooth/state.json, falling
+// back to ~/.local/state as the XDG spec says.
+func defaultStatePath() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "hyprBluetooth", "state.json"), nil
+}
+
+// loadState reads the state file; a missing file is an empty state.
+func loadState(path string) (uiState, error) {
+	s := uiState{Sort: sortDefault}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to read state: %w", err)
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return uiState{Sort: sortDefault}, fmt.Errorf("failed to parse state %s: %w", path, err)
+	}
+	if _, ok := parseSortMode(string(s.Sort)); !ok {
+		s.Sort = sortDefault
+	}
+	return s, nil
+}
+
+// saveState replaces the state file atomically so a crash can't leave it
+// half written.
+func saveState(path string, s uiState) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a private temporary file beside path,
+// syncs it and renames it into place, creating the directory if needed.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
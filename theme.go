@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// palette is the handful of colors every style is built from. An empty
+// color leaves the terminal's own.
+type palette struct {
+	Accent lipgloss.Color
+	// Title is text drawn on Accent.
+	Title      lipgloss.Color
+	Foreground lipgloss.Color
+	Success    lipgloss.Color
+	Warning    lipgloss.Color
+	Error      lipgloss.Color
+	Muted      lipgloss.Color
+	Selection  lipgloss.Color
+	Match      lipgloss.Color
+}
+
+var defaultPalette = palette{
+	Accent:     "#7D56F4",
+	Title:      "#FAFAFA",
+	Foreground: "#FAFAFA",
+	Success:    "#04B575",
+	Warning:    "#FFA500",
+	Error:      "#FF5F56",
+	Muted:      "#626262",
+	Selection:  "#383838",
+	Match:      "#FFD700",
+}
+
+// themes are the built-in palettes.
+var themes = map[string]palette{
+	"default": defaultPalette,
+	"catppuccin": {
+		Accent:     "#CBA6F7",
+		Title:      "#1E1E2E",
+		Foreground: "#CDD6F4",
+		Success:    "#A6E3A1",
+		Warning:    "#FAB387",
+		Error:      "#F38BA8",
+		Muted:      "#6C7086",
+		Selection:  "#313244",
+		Match:      "#F9E2AF",
+	},
+	"gruvbox": {
+		Accent:     "#83A598",
+		Title:      "#282828",
+		Foreground: "#EBDBB2",
+		Success:    "#B8BB26",
+		Warning:    "#FABD2F",
+		Error:      "#FB4934",
+		Muted:      "#928374",
+		Selection:  "#3C3836",
+		Match:      "#FE8019",
+	},
+	"nord": {
+		Accent:     "#88C0D0",
+		Title:      "#2E3440",
+		Foreground: "#ECEFF4",
+		Success:    "#A3BE8C",
+		Warning:    "#EBCB8B",
+		Error:      "#BF616A",
+		Muted:      "#616E88",
+		Selection:  "#3B4252",
+		Match:      "#D08770",
+	},
+	// high-contrast sticks to the 16 ANSI colors, which every terminal
+	// can show and many users have tuned.
+	"high-contrast": {
+		Accent:     "15",
+		Title:      "0",
+		Foreground: "15",
+		Success:    "10",
+		Warning:    "11",
+		Error:      "9",
+		Muted:      "7",
+		Selection:  "8",
+		Match:      "14",
+	},
+	// monochrome leaves every color to the terminal; applyPalette
+	// falls back to reverse video where a background marked something.
+	"monochrome": {},
+}
+
+// themeNames lists the built-in themes for messages.
+var themeNames = []string{"default", "catppuccin", "gruvbox", "nord", "high-contrast", "monochrome"}
+
+// paletteKeys are the names colors are configured with, in field order.
+var paletteKeys = []string{"accent", "title", "foreground", "success", "warning", "error", "muted", "selection", "match"}
+
+func (p *palette) field(key string) *lipgloss.Color {
+	switch key {
+	case "accent":
+		return &p.Accent
+	case "title":
+		return &p.Title
+	case "foreground":
+		return &p.Foreground
+	case "success":
+		return &p.Success
+	case "warning":
+		return &p.Warning
+	case "error":
+		return &p.Error
+	case "muted":
+		return &p.Muted
+	case "selection":
+		return &p.Selection
+	case "match":
+		return &p.Match
+	}
+	return nil
+}
+
+var hexColor = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// withColors overrides p with colors given as "#RRGGBB" or an ANSI color
+// number (0-255).
+func (p palette) withColors(colors map[string]string) (palette, error) {
+	for key, value := range colors {
+		c := p.field(key)
+		if c == nil {
+			return p, fmt.Errorf("unknown color %q; use one of %s", key, strings.Join(paletteKeys, ", "))
+		}
+		if n, err := strconv.Atoi(value); !hexColor.MatchString(value) && (err != nil || n < 0 || n > 255) {
+			return p, fmt.Errorf("invalid color %s = %q; use #RRGGBB or 0-255", key, value)
+		}
+		*c = lipgloss.Color(value)
+	}
+	return p, nil
+}
+
+// loadTheme returns the built-in theme called name, or reads a user theme:
+// name.toml in dir, or name itself when it is a path to a .toml file. A
+// user theme sets colors as [colors] does, over the default palette.
+func loadTheme(name, dir string) (palette, error) {
+	if p, ok := themes[name]; ok {
+		return p, nil
+	}
+	path := name
+	if !strings.HasSuffix(name, ".toml") {
+		if strings.ContainsRune(name, filepath.Separator) {
+			return palette{}, fmt.Errorf("theme file %s must end in .toml", name)
+		}
+		path = filepath.Join(dir, name+".toml")
+	}
+	var colors map[string]string
+	if _, err := toml.DecodeFile(path, &colors); err != nil {
+		if errors.Is(err, fs.ErrNotExist) && path != name {
+			return palette{}, fmt.Errorf("unknown theme %q; use one of %s, or add %s", name, strings.Join(themeNames, ", "), path)
+		}
+		return palette{}, fmt.Errorf("failed to load theme %s: %w", path, err)
+	}
+	p, err := defaultPalette.withColors(colors)
+	if err != nil {
+		return palette{}, fmt.Errorf("theme %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// forTerminal drops to monochrome when colors are unwanted (NO_COLOR) or
+// can't be shown. Richer profiles are left to lipgloss, which maps hex
+// colors down to 256 or 16 as the terminal needs.
+func (p palette) forTerminal(noColor bool, profile termenv.Profile) palette {
+	if noColor || profile == termenv.Ascii {
+		return themes["monochrome"]
+	}
+	return p
+}
+
+// applyPalette rebuilds the package's styles from p.
+func applyPalette(p palette) {
+	titleStyle = lipgloss.NewStyle().
+		Foreground(p.Title).
+		Background(p.Accent).
+		Padding(0, 1).
+		Bold(true)
+	if p.Accent == "" {
+		titleStyle = titleStyle.Reverse(true)
+	}
+
+	btOnStyle = lipgloss.NewStyle().
+		Bold(true).
+		Foreground(p.Success)
+
+	btOffStyle = lipgloss.NewStyle().
+		Bold(true).
+		Foreground(p.Error)
+
+	scanStyle = lipgloss.NewStyle().
+		Foreground(p.Success).
+		Bold(true)
+
+	disabledStyle = lipgloss.NewStyle().
+		Foreground(p.Error).
+		Italic(true)
+
+	noDevicesStyle = lipgloss.NewStyle().
+		Foreground(p.Muted).
+		Italic(true)
+
+	helpStyle = lipgloss.NewStyle().
+		Foreground(p.Muted).
+		MarginTop(2)
+
+	errorStyle = lipgloss.NewStyle().
+		Foreground(p.Error).
+		Bold(true).
+		MarginTop(1)
+
+	cursorRowStyle = lipgloss.NewStyle().Background(p.Selection)
+	if p.Selection == "" {
+		cursorRowStyle = cursorRowStyle.Reverse(true)
+	}
+
+	groupHeaderStyle = lipgloss.NewStyle().Foreground(p.Accent).Bold(true)
+
+	scrollIndicatorStyle = lipgloss.NewStyle().Foreground(p.Muted)
+
+	statusConnectedStyle = lipgloss.NewStyle().Foreground(p.Success)
+	statusPairedStyle = lipgloss.NewStyle().Foreground(p.Warning)
+	statusUnpairedStyle = lipgloss.NewStyle().Foreground(p.Muted)
+	statusBlockedStyle = lipgloss.NewStyle().Foreground(p.Error)
+
+	batteryHighStyle = lipgloss.NewStyle().Foreground(p.Success)
+	batteryMidStyle = lipgloss.NewStyle().Foreground(p.Warning)
+	batteryLowStyle = lipgloss.NewStyle().Foreground(p.Error)
+
+	warningStyle = lipgloss.NewStyle().
+		Foreground(p.Warning).
+		Bold(true)
+
+	dialogStyle = lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(p.Accent).
+		Padding(0, 1)
+
+	passkeyStyle = lipgloss.NewStyle().
+		Foreground(p.Foreground).
+		Bold(true)
+
+	searchMatchStyle = lipgloss.NewStyle().
+		Foreground(p.Match).
+		Bold(true).
+		Underline(true)
+}
+
+func init() {
+	applyPalette(defaultPalette)
+}
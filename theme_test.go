@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+func TestLoadTheme(t *testing.T) {
+	for _, name := range themeNames {
+		if _, err := loadTheme(name, t.TempDir()); err != nil {
+			t.Errorf("built-in theme %s: %v", name, err)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "dusk.toml"), []byte("accent = \"#102030\"\nmuted = \"244\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.toml"), []byte("accent = \"dark\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := loadTheme("dusk", dir)
+	if err != nil || p.Accent != lipgloss.Color("#102030") || p.Muted != lipgloss.Color("244") || p.Error != defaultPalette.Error {
+		t.Errorf("loadTheme(dusk) = %+v, %v", p, err)
+	}
+	if p, err := loadTheme(filepath.Join(dir, "dusk.toml"), ""); err != nil || p.Accent != lipgloss.Color("#102030") {
+		t.Errorf("loadTheme(path) = %+v, %v", p, err)
+	}
+
+	for name, want := range map[string]string{
+		"solarized":                     "unknown theme",
+		"broken":                        "invalid color accent",
+		filepath.Join(dir, "dusk"):      "must end in .toml",
+		filepath.Join(dir, "none.toml"): "failed to load theme",
+	} {
+		if _, err := loadTheme(name, dir); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loadTheme(%s) error = %v, want %q", name, err, want)
+		}
+	}
+}
+
+func TestPaletteForTerminal(t *testing.T) {
+	nord := themes["nord"]
+	tests := []struct {
+		noColor bool
+		profile termenv.Profile
+		want    palette
+	}{
+		{false, termenv.TrueColor, nord},
+		{false, termenv.ANSI, nord},
+		{true, termenv.TrueColor, palette{}},
+		{false, termenv.Ascii, palette{}},
+	}
+	for _, tc := range tests {
+		if got := nord.forTerminal(tc.noColor, tc.profile); got != tc.want {
+			t.Errorf("forTerminal(%v, %v) = %+v", tc.noColor, tc.profile, got)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	waybarPollInterval = 5 * time.Second
+
+	waybarClassOff       = "off"
+	waybarClassOn        = "on"
+	waybarClassConnected = "connected"
+)
+
+// waybarOutput is one line in Waybar's custom module "return-type": "json"
+// format. Alt mirrors Class so "format-icons" can be keyed on state, and
+// Percentage is the first connected device's battery when it reports one.
+type waybarOutput struct {
+	Text       string `json:"text"`
+	Alt        string `json:"alt"`
+	Tooltip    string `json:"tooltip"`
+	Class      string `json:"class"`
+	Percentage int    `json:"percentage"`
+}
+
+func waybarState(powered bool, devices []BluetoothDevice) waybarOutput {
+	if !powered {
+		return waybarOutput{Text: "off", Alt: waybarClassOff, Class: waybarClassOff, Tooltip: "Bluetooth is off"}
+	}
+
+	var connected []BluetoothDevice
+	for _, d := range devices {
+		if d.Connected {
+			connected = append(connected, d)
+		}
+	}
+	if len(connected) == 0 {
+		return waybarOutput{Text: "on", Alt: waybarClassOn, Class: waybarClassOn, Tooltip: "No devices connected"}
+	}
+
+	lines := make([]string, 0, len(connected))
+	for _, d := range connected {
+		line := fmt.Sprintf("%s (%s)", d.DisplayName(), d.MAC)
+		if d.HasBattery {
+			line += fmt.Sprintf(" %d%%", d.Battery)
+		}
+		lines = append(lines, line)
+	}
+	percentage := 100
+	if connected[0].HasBattery {
+		percentage = connected[0].Battery
+	}
+	text := connected[0].DisplayName()
+	if len(connected) > 1 {
+		text = fmt.Sprintf("%d devices", len(connected))
+	}
+	return waybarOutput{
+		Text:       text,
+		Alt:        waybarClassConnected,
+		Class:      waybarClassConnected,
+		Tooltip:    strings.Join(lines, "\n"),
+		Percentage: percentage,
+	}
+}
+
+func runWaybar(ctx context.Context, c *cli, args []string) error {
+	if len(args) == 0 {
+		return waybarWatch(ctx, c)
+	}
+	switch args[0] {
+	case "watch":
+		return waybarWatch(ctx, c)
+	case "toggle":
+		return runPower(ctx, c, []string{"toggle"})
+	case "next":
+		return waybarCycle(ctx, c, 1)
+	case "prev":
+		return waybarCycle(ctx, c, -1)
+	}
+	return usageError("expected watch, toggle, next or prev, got %q", args[0])
+}
+
+// waybarWatch prints the module state whenever it changes. It follows the
+// backend's event stream and falls back to polling if there isn't one.
+func waybarWatch(ctx context.Context, c *cli) error {
+	w := &waybarWatcher{c: c}
+	if err := w.refresh(ctx); err != nil {
+		return err
+	}
+	if err := w.emit(); err != nil {
+		return err
+	}
+
+	events, err := c.backend.Events(ctx)
+	if err != nil {
+		events = nil
+	}
+	ticker := time.NewTicker(waybarPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			w.apply(ev)
+		case <-ticker.C:
+			if events != nil {
+				continue
+			}
+			if err := w.refresh(ctx); err != nil {
+				fmt.Fprintf(c.stderr, "hyprBluetooth waybar: %v\n", err)
+				continue
+			}
+		}
+		if err := w.emit(); err != nil {
+			return err
+		}
+	}
+}
+
+// waybarWatcher is the state waybarWatch prints, and the last line it
+// printed.
+type waybarWatcher struct {
+	c       *cli
+	powered bool
+	devices []BluetoothDevice
+	last    string
+}
+
+func (w *waybarWatcher) refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, w.c.timeouts.Command)
+	defer cancel()
+	var err error
+	if w.powered, err = w.c.backend.Powered(ctx); err != nil {
+		return err
+	}
+	w.devices, err = w.c.backend.ListDevices(ctx)
+	return err
+}
+
+func (w *waybarWatcher) apply(ev Event) {
+	if ev.Kind == EventPowerChanged {
+		w.powered = ev.Powered
+	} else {
+		w.devices = applyDeviceEvent(w.devices, ev)
+	}
+}
+
+// emit prints the state unless it's what was printed last.
+func (w *waybarWatcher) emit() error {
+	b, err := json.Marshal(waybarState(w.powered, w.devices))
+	if err != nil {
+		return err
+	}
+	if line := string(b); line != w.last {
+		w.last = line
+		_, err = fmt.Fprintln(w.c.stdout, line)
+	}
+	return err
+}
+
+// waybarCycle moves the connection to the next (step 1) or previous (step
+// -1) paired device, for binding to the module's scroll actions.
+func waybarCycle(ctx context.Context, c *cli, step int) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.Command)
+	defer cancel()
+	devices, err := c.backend.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+
+	var paired []BluetoothDevice
+	current := -1
+	for _, d := range devices {
+		if !d.Paired {
+			continue
+		}
+		if d.Connected && current < 0 {
+			current = len(paired)
+		}
+		paired = append(paired, d)
+	}
+	if len(paired) == 0 {
+		return fmt.Errorf("%w: no paired devices", errDeviceNotFound)
+	}
+
+	next := 0
+	switch {
+	case current >= 0:
+		next = (current + step + len(paired)) % len(paired)
+	case step < 0:
+		next = len(paired) - 1
+	}
+	if current >= 0 {
+		if next == current {
+			return nil
+		}
+		if err := c.backend.Disconnect(ctx, paired[current].MAC); err != nil {
+			return err
+		}
+	}
+	return c.backend.Connect(ctx, paired[next].MAC)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWaybarState(t *testing.T) {
+	devices := newFakeBackend().devices
+
+	off := waybarState(false, devices)
+	if off.Class != waybarClassOff || off.Percentage != 0 {
+		t.Errorf("powered off: got %+v", off)
+	}
+
+	on := waybarState(true, devices[1:])
+	if on.Class != waybarClassOn || on.Text != "on" {
+		t.Errorf("nothing connected: got %+v", on)
+	}
+
+	one := waybarState(true, devices)
+	if one.Class != waybarClassConnected || one.Text != "WH-1000XM4" || one.Percentage != 100 {
+		t.Errorf("one connected: got %+v", one)
+	}
+
+	devices[0].Battery, devices[0].HasBattery = 40, true
+	if got := waybarState(true, devices); got.Percentage != 40 || !strings.HasSuffix(got.Tooltip, " 40%") {
+		t.Errorf("battery: got %+v", got)
+	}
+
+	devices[1].Connected = true
+	two := waybarState(true, devices)
+	if two.Text != "2 devices" || strings.Count(two.Tooltip, "\n") != 1 {
+		t.Errorf("two connected: got %+v", two)
+	}
+}
+
+func TestWaybarCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		setup func(*fakeBackend)
+		calls []string
+	}{
+		{
+			name:  "next wraps to first paired",
+			args:  []string{"waybar", "next"},
+			calls: []string{"disconnect " + testMACHeadphones, "connect " + testMACMouse},
+		},
+		{
+			name:  "prev from first wraps to last paired",
+			args:  []string{"waybar", "prev"},
+			calls: []string{"disconnect " + testMACHeadphones, "connect " + testMACMouse},
+		},
+		{
+			name:  "nothing connected connects first",
+			args:  []string{"waybar", "next"},
+			setup: func(b *fakeBackend) { b.devices[0].Connected = false },
+			calls: []string{"connect " + testMACHeadphones},
+		},
+		{
+			name:  "single paired device stays connected",
+			args:  []string{"waybar", "next"},
+			setup: func(b *fakeBackend) { b.devices[1].Paired = false },
+			calls: nil,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newFakeBackend()
+			if tc.setup != nil {
+				tc.setup(b)
+			}
+			if code, _, stderr := runCLIForTest(b, tc.args...); code != exitOK {
+				t.Fatalf("exit code = %d (stderr: %s)", code, stderr)
+			}
+			if strings.Join(b.calls, ",") != strings.Join(tc.calls, ",") {
+				t.Errorf("calls = %v, want %v", b.calls, tc.calls)
+			}
+		})
+	}
+}
+
+func TestWaybarWatchFollowsEvents(t *testing.T) {
+	b := newFakeBackend()
+	b.events = make(chan Event)
+	r, w := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- waybarWatch(ctx, &cli{backend: b, stdout: w, stderr: io.Discard})
+		w.Close()
+	}()
+
+	lines := bufio.NewScanner(r)
+	next := func() waybarOutput {
+		t.Helper()
+		if !lines.Scan() {
+			t.Fatal("waybar output ended early")
+		}
+		var out waybarOutput
+		if err := json.Unmarshal(lines.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	if got := next(); got.Class != waybarClassConnected {
+		t.Errorf("initial state = %+v, want connected", got)
+	}
+
+	headphones := b.devices[0]
+	headphones.Connected = false
+	b.events <- Event{Kind: EventDeviceChanged, Device: headphones}
+	if got := next(); got.Class != waybarClassOn {
+		t.Errorf("after disconnect = %+v, want on", got)
+	}
+
+	// An event that doesn't change the output must not print a line.
+	b.events <- Event{Kind: EventDeviceChanged, Device: headphones}
+	b.events <- Event{Kind: EventPowerChanged, Powered: false}
+	if got := next(); got.Class != waybarClassOff {
+		t.Errorf("after power off = %+v, want off", got)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("waybarWatch returned %v", err)
+	}
+}